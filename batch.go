@@ -0,0 +1,156 @@
+package rollrus
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rollbar/rollbar-go"
+)
+
+// batcher coalesces identical reports and sends each of them once per
+// interval with the number of occurrences attached.
+type batcher struct {
+	hook     *Hook
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*batchedItem
+	order   []string
+	closed  bool
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// batchedItem is a report waiting to be sent by a batcher.
+type batchedItem struct {
+	severity   string
+	err        error
+	message    string
+	request    *http.Request
+	occurrence *occurrence
+	extras     map[string]interface{}
+	client     *rollbar.Client
+	count      int
+}
+
+func newBatcher(h *Hook, interval time.Duration) *batcher {
+	return &batcher{
+		hook:     h,
+		interval: interval,
+		pending:  make(map[string]*batchedItem),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// add queues the item, merging it with an identical pending one. The
+// background flusher is started on first use. Items added after close are
+// sent right away.
+func (b *batcher) add(it *batchedItem) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		it.count = 1
+		b.hook.sendBatched(it)
+		return
+	}
+
+	key := fmt.Sprintf("%p|%s|%T|%v|%s", it.client, it.severity, it.err, it.err, it.message)
+	if p, ok := b.pending[key]; ok {
+		p.count++
+	} else {
+		it.count = 1
+		b.pending[key] = it
+		b.order = append(b.order, key)
+	}
+	b.mu.Unlock()
+
+	b.startOnce.Do(func() { go b.run() })
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	ticker := b.hook.timer().NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			b.flush()
+		case <-b.stop:
+			b.flush()
+			return
+		}
+	}
+}
+
+// flush sends all pending items.
+func (b *batcher) flush() {
+	b.hook.clientLock().RLock()
+	defer b.hook.clientLock().RUnlock()
+	b.flushLocked()
+}
+
+// flushLocked works like flush for callers already holding the client lock of
+// the hook.
+func (b *batcher) flushLocked() {
+	b.mu.Lock()
+	pending, order := b.pending, b.order
+	b.pending, b.order = make(map[string]*batchedItem), nil
+	b.mu.Unlock()
+
+	for _, key := range order {
+		b.hook.sendBatched(pending[key])
+	}
+}
+
+// close stops the background flusher after sending all pending items.
+func (b *batcher) close() {
+	b.stopOnce.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+
+		started := true
+		b.startOnce.Do(func() { started = false })
+		if !started {
+			b.flush()
+			return
+		}
+		close(b.stop)
+		<-b.done
+	})
+}
+
+// sendBatched sends an item collected by the batcher, using the occurrence and
+// stack that were captured when the first entry was logged.
+func (r *Hook) sendBatched(it *batchedItem) {
+	extras := make(map[string]interface{}, len(it.extras)+2)
+	for k, v := range it.extras {
+		extras[k] = v
+	}
+	extras["occurrence_count"] = it.count
+
+	if _, ok := it.err.(rollbar.CauseStacker); ok {
+		// the error carries its own stack
+		it.occurrence.stack = nil
+	}
+	r.attachOccurrence(it.client, extras, it.occurrence)
+
+	switch {
+	case it.err == nil && it.request != nil:
+		it.client.RequestMessageWithExtras(it.severity, it.request, it.message, extras)
+	case it.err == nil:
+		it.client.MessageWithExtras(it.severity, it.message, extras)
+	case it.request != nil:
+		it.client.RequestErrorWithStackSkipWithExtras(it.severity, it.request, it.err, 0, extras)
+	default:
+		it.client.ErrorWithStackSkipWithExtras(it.severity, it.err, 0, extras)
+	}
+}
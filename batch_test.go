@@ -0,0 +1,112 @@
+package rollrus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithBatching(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	h := NewHook("", "testing", WithClock(clock), WithBatching(time.Hour))
+	defer h.Close()
+	ft := withFakeTransport(h, &fakeTransport{})
+	l := logrus.New()
+	l.AddHook(h)
+
+	for i := 0; i < 3; i++ {
+		l.WithError(errors.New("boom")).Error("This is a test")
+	}
+	l.Error("Something else")
+
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected reports to be batched, got %d sent", len(ft.sent))
+	}
+
+	// The second tick is only received once the first one has been handled.
+	clock.ticks <- clock.Now()
+	clock.ticks <- clock.Now()
+
+	if len(ft.sent) != 2 {
+		t.Fatalf("expected 2 reports to be sent on the tick, got %d", len(ft.sent))
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	custom := data["custom"].(map[string]interface{})
+	if custom["occurrence_count"] != 3 {
+		t.Errorf("expected an occurrence_count of 3, got %v", custom["occurrence_count"])
+	}
+	if _, exists := custom[occurrenceKey]; exists {
+		t.Error("expected the occurrence to be removed from the custom data")
+	}
+
+	trace := data["body"].(map[string]interface{})["trace_chain"].([]map[string]interface{})[0]
+	frames := trace["frames"].(rollbar.Stack)
+	if len(frames) == 0 || !strings.Contains(frames[0].Method, "TestWithBatching") {
+		t.Errorf("expected the stack to start at the logging call, got %v", frames)
+	}
+}
+
+func TestWithBatchingSendsFatalImmediately(t *testing.T) {
+	h := NewHook("", "testing", WithBatching(time.Hour))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.PanicLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected the panic to be sent right away, got %d sent", len(ft.sent))
+	}
+}
+
+func TestWithBatchingFlushesOnFatal(t *testing.T) {
+	h := NewHook("", "testing", WithBatching(time.Hour))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["err"] = errors.New("boom")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected the error to be batched, got %d sent", len(ft.sent))
+	}
+
+	entry.Level = logrus.FatalLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 2 {
+		t.Fatalf("expected the pending error to be sent with the fatal one, got %d sent", len(ft.sent))
+	}
+}
+
+func TestWithBatchingRejectsNonPositiveInterval(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("", "testing", WithDiagnosticWriter(&buf), WithBatching(0))
+	ft := withFakeTransport(h, &fakeTransport{})
+	if h.batch != nil || !strings.Contains(buf.String(), "WithBatching needs a positive interval") {
+		t.Fatalf("expected batching to be rejected with a warning, got %q", buf.String())
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 1 {
+		t.Errorf("expected the report to be sent right away, got %d sent", len(ft.sent))
+	}
+}
@@ -0,0 +1,20 @@
+package rollrus
+
+import "runtime/debug"
+
+// readBuildInfo is a variable so that tests can provide build info.
+var readBuildInfo = debug.ReadBuildInfo
+
+// buildInfo returns the version of the main module, the VCS revision it was
+// built from and whether the working tree was modified, if they are known.
+func buildInfo() (version, revision string, modified bool) {
+	bi, ok := readBuildInfo()
+	if !ok || bi == nil {
+		return "", "", false
+	}
+	if version = bi.Main.Version; version == "(devel)" {
+		version = ""
+	}
+	revision, modified = vcsInfo(bi)
+	return version, revision, modified
+}
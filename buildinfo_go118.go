@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package rollrus
+
+import "runtime/debug"
+
+// vcsInfo returns the VCS revision recorded in the build info and whether the
+// working tree had local modifications.
+func vcsInfo(bi *debug.BuildInfo) (revision string, modified bool) {
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	return revision, modified
+}
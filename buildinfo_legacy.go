@@ -0,0 +1,12 @@
+//go:build !go1.18
+// +build !go1.18
+
+package rollrus
+
+import "runtime/debug"
+
+// vcsInfo returns no revision, as Go versions before 1.18 don't record VCS
+// information in the build info.
+func vcsInfo(bi *debug.BuildInfo) (revision string, modified bool) {
+	return "", false
+}
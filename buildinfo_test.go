@@ -0,0 +1,70 @@
+//go:build go1.18
+// +build go1.18
+
+package rollrus
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestWithBuildInfo(t *testing.T) {
+	defer func(orig func() (*debug.BuildInfo, bool)) { readBuildInfo = orig }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main:     debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+			Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}},
+		}, true
+	}
+
+	h := NewHook("", "testing", WithBuildInfo())
+	if h.extras["module_version"] != "v1.2.3" || h.extras["vcs_revision"] != "abc123" {
+		t.Errorf("expected the build info extras, got %v", h.extras)
+	}
+	if v := h.Client.CodeVersion(); v != "abc123" {
+		t.Errorf("expected the revision as code version, got %q", v)
+	}
+
+	h = NewHookForLevels("", "testing", nil)
+	h.Client.SetCodeVersion("v9")
+	WithBuildInfo()(h)
+	if v := h.Client.CodeVersion(); v != "v9" {
+		t.Errorf("expected the code version to be kept, got %q", v)
+	}
+}
+
+func TestWithBuildInfoUnavailable(t *testing.T) {
+	defer func(orig func() (*debug.BuildInfo, bool)) { readBuildInfo = orig }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+
+	h := NewHook("", "testing", WithBuildInfo())
+	if h.extras != nil || h.Client.CodeVersion() != "" {
+		t.Errorf("expected nothing to be set, got %v and %q", h.extras, h.Client.CodeVersion())
+	}
+}
+
+func TestWithBuildInfoCodeVersion(t *testing.T) {
+	defer func(orig func() (*debug.BuildInfo, bool)) { readBuildInfo = orig }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.modified", Value: "true"},
+			},
+		}, true
+	}
+
+	h := NewHook("", "testing", WithCodeVersion("v9"), WithBuildInfoCodeVersion())
+	if v := h.Client.CodeVersion(); v != "abc123" {
+		t.Errorf("expected the revision as code version, got %q", v)
+	}
+	if h.extras["vcs_modified"] != true {
+		t.Errorf("expected the vcs_modified extra, got %v", h.extras)
+	}
+
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	h = NewHook("", "testing", WithCodeVersion("v9"), WithBuildInfoCodeVersion())
+	if v := h.Client.CodeVersion(); v != "v9" {
+		t.Errorf("expected the code version to be kept, got %q", v)
+	}
+}
@@ -0,0 +1,47 @@
+package rollrus
+
+import "time"
+
+// Clock tells the hook the current time and lets it wait, for the backoff of
+// WithRetry and the interval of WithBatching. It can be replaced with
+// WithClock, for example to make time dependent behavior deterministic in
+// tests.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// wallClock is the default Clock.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (wallClock) NewTicker(d time.Duration) Ticker {
+	return wallTicker{time.NewTicker(d)}
+}
+
+// wallTicker is the Ticker of wallClock.
+type wallTicker struct {
+	t *time.Ticker
+}
+
+func (t wallTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t wallTicker) Stop() {
+	t.t.Stop()
+}
@@ -0,0 +1,151 @@
+package rollrus
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Clone returns a copy of the hook with opts applied on top of its options,
+// for example to attach variants with other ignore functions or custom data
+// to the loggers of different subsystems. The copy shares the client, and
+// with it the token, as well as the rate and concurrency limits, but keeps its
+// own Stats, batch and telemetry. Options that configure the client, like
+// WithEndpoint or WithAsync, therefore change it for both hooks; pass
+// WithClient to give the copy a client of its own. Closing either hook
+// closes a shared client.
+func (r *Hook) Clone(opts ...OptionFunc) *Hook {
+	r.levelsMu.RLock()
+	triggers, levelsSet := r.triggers, r.levelsSet
+	r.levelsMu.RUnlock()
+
+	c := &Hook{
+		Client:          r.Client,
+		triggers:        triggers[:len(triggers):len(triggers)],
+		ignoredErrors:   r.ignoredErrors[:len(r.ignoredErrors):len(r.ignoredErrors)],
+		ignoreErrorFunc: r.ignoreErrorFunc,
+		countedIgnore:   r.countedIgnore,
+		ignoreFunc:      r.ignoreFunc,
+		skipIf:          r.skipIf,
+		tags:            r.tags[:len(r.tags):len(r.tags)],
+		dynamicMinLevel: r.dynamicMinLevel,
+		observeLevels:   r.observeLevels[:len(r.observeLevels):len(r.observeLevels)],
+		levelFilter:     r.levelFilter,
+		errorTypeLevels: r.errorTypeLevels[:len(r.errorTypeLevels):len(r.errorTypeLevels)],
+		sentinelGroups:  r.sentinelGroups[:len(r.sentinelGroups):len(r.sentinelGroups)],
+		groupByFields:   r.groupByFields,
+
+		ignoreContextErrors: r.ignoreContextErrors,
+
+		retryAttempts: r.retryAttempts,
+		retryBackoff:  r.retryBackoff,
+		onError:       r.onError,
+		errorHandler:  r.errorHandler,
+
+		propagateErrors: r.propagateErrors,
+
+		skipOnCanceledContext: r.skipOnCanceledContext,
+		shutdownTimeout:       r.shutdownTimeout,
+		httpClient:            r.httpClient,
+		stackExtractor:        r.stackExtractor,
+		clock:                 r.clock,
+		callerInfo:            r.callerInfo,
+		fieldFormatter:        r.fieldFormatter,
+		keyRenames:            r.keyRenames[:len(r.keyRenames):len(r.keyRenames)],
+		fieldAllowlist:        copySet(r.fieldAllowlist),
+		omitWarningStack:      r.omitWarningStack,
+		extras:                copyExtras(r.extras),
+		framework:             r.framework,
+		serverBranch:          r.serverBranch,
+		redactParams:          copySet(r.redactParams),
+		scrubFields:           r.scrubFields,
+		itemCustomizer:        r.itemCustomizer,
+		projectRoutes:         r.projectRoutes,
+		additionalClients:     r.additionalClients[:len(r.additionalClients):len(r.additionalClients)],
+		levelTokens:           r.levelTokens,
+		tokenRouter:           r.tokenRouter,
+		projectField:          r.projectField,
+		envSuffixField:        r.envSuffixField,
+		envSuffixSep:          r.envSuffixSep,
+		causeField:            r.causeField,
+		reports:               r.reports,
+		panicStackDepth:       r.panicStackDepth,
+		collapseFrames:        r.collapseFrames,
+		source:                r.source,
+		titleTemplate:         r.titleTemplate,
+		personFunc:            r.personFunc,
+		diagnostics:           r.diagnostics,
+		logger:                r.logger,
+
+		dryRun: r.dryRun,
+
+		limiter: r.limiter,
+
+		sem:     r.sem,
+		semWait: r.semWait,
+
+		omitSyntheticFields: r.omitSyntheticFields,
+		maxMessageLength:    r.maxMessageLength,
+
+		dropIfNoError: r.dropIfNoError,
+
+		triggersSetBy:    r.triggersSetBy,
+		triggersConflict: r.triggersConflict,
+
+		recentLogsSize: r.recentLogsSize,
+
+		levelsSet:        levelsSet,
+		adjustableLevels: r.adjustableLevels,
+
+		disabled:    atomic.LoadInt32(&r.disabled),
+		envDisabled: atomic.LoadInt32(&r.envDisabled),
+		enabledEnvs: r.enabledEnvs,
+
+		origin: r.clientOrigin(),
+	}
+	if r.batch != nil {
+		c.batch = newBatcher(c, r.batch.interval)
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// clientOrigin returns the hook whose client this hook shares, which is the
+// hook itself unless it was made by Clone.
+func (r *Hook) clientOrigin() *Hook {
+	if r.origin != nil {
+		return r.origin
+	}
+	return r
+}
+
+// clientLock returns the lock guarding the credentials of the client, which
+// is shared with the hook the client came from.
+func (r *Hook) clientLock() *sync.RWMutex {
+	return &r.clientOrigin().clientMu
+}
+
+func copySet(m map[string]bool) map[string]bool {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]bool, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyExtras(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,61 @@
+package rollrus
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestClone(t *testing.T) {
+	h := NewHook("", "testing", WithIgnoredErrors(io.EOF), WithCustom(map[string]interface{}{"service": "api"}))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	c := h.Clone(
+		WithIgnoredErrors(io.ErrUnexpectedEOF),
+		WithCustom(map[string]interface{}{"subsystem": "worker"}),
+	)
+	if c.Client != h.Client {
+		t.Fatal("expected the clone to share the client")
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	for _, err := range []error{io.EOF, io.ErrUnexpectedEOF} {
+		entry.Data["err"] = err
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+		if err := c.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if got := len(ft.sent); got != 1 {
+		t.Fatalf("expected only the original to report io.ErrUnexpectedEOF, got %d sent", got)
+	}
+	if _, ok := h.extras["subsystem"]; ok {
+		t.Error("expected the clone's custom data not to change the original")
+	}
+	if c.extras["service"] != "api" || c.extras["subsystem"] != "worker" {
+		t.Errorf("expected the clone to keep and extend the custom data, got %v", c.extras)
+	}
+	if s := h.Stats(); s.Reported != 1 || s.Ignored != 1 {
+		t.Errorf("expected one report and one ignored entry for the original, got %+v", s)
+	}
+	if s := c.Stats(); s.Reported != 0 || s.Ignored != 2 {
+		t.Errorf("expected two ignored entries for the clone, got %+v", s)
+	}
+
+	entry.Data["err"] = io.ErrClosedPipe
+	if err := c.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if got := len(ft.sent); got != 2 {
+		t.Fatalf("expected the clone to report through the shared client, got %d sent", got)
+	}
+	if h.Stats().Reported != 1 || c.Stats().Reported != 1 {
+		t.Errorf("expected the clone's report to be counted by the clone, got %+v and %+v", h.Stats(), c.Stats())
+	}
+}
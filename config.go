@@ -0,0 +1,101 @@
+package rollrus
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the configuration of a hook created by NewHookFromConfig, for
+// example when it is read from a file or flags. The zero value of a field
+// keeps the default of NewHook.
+type Config struct {
+	// Token is the Rollbar access token. It is required.
+	Token string
+	// Environment reported with every item. It is required.
+	Environment string
+	// Endpoint items are posted to, see WithEndpoint.
+	Endpoint string
+	// CodeVersion reported with every item, see WithCodeVersion.
+	CodeVersion string
+	// Platform reported with every item, see WithPlatform.
+	Platform string
+	// ServerHost reported with every item, see WithServerHost.
+	ServerHost string
+	// ServerRoot reported with every item, see WithServerRoot.
+	ServerRoot string
+	// Levels reported on, see WithLevels.
+	Levels []logrus.Level
+	// ScrubFields are the names of extras and request parameters to scrub,
+	// see WithScrubFields.
+	ScrubFields []string
+	// ScrubHeaders are the names of request headers to scrub, see
+	// WithScrubHeaders.
+	ScrubHeaders []string
+	// IgnoredErrors are not reported, see WithIgnoredErrors.
+	IgnoredErrors []error
+	// Custom data added to every report, see WithCustom.
+	Custom map[string]interface{}
+	// Async sends items asynchronously, queueing up to AsyncBufferSize of
+	// them, see WithAsync.
+	Async           bool
+	AsyncBufferSize int
+}
+
+// errConfigWithClient is returned by NewHookFromConfig when WithClient replaces
+// the client the Config was applied to.
+var errConfigWithClient = errors.New("rollrus: the client settings of Config can't be combined with WithClient")
+
+// NewHookFromConfig creates a hook like NewHook from the configuration, with
+// the opts applied after it. It returns an error if the hook is invalid, see
+// Validate, or if opts include WithClient while the Config has settings of the
+// client, like Endpoint or Async, which would be lost with the hook's own
+// client.
+func NewHookFromConfig(c Config, opts ...OptionFunc) (*Hook, error) {
+	var clientOpts, hookOpts []OptionFunc
+	for _, s := range []struct {
+		value string
+		opt   func(string) OptionFunc
+	}{
+		{c.Endpoint, WithEndpoint},
+		{c.CodeVersion, WithCodeVersion},
+		{c.Platform, WithPlatform},
+		{c.ServerHost, WithServerHost},
+		{c.ServerRoot, WithServerRoot},
+	} {
+		if s.value != "" {
+			clientOpts = append(clientOpts, s.opt(s.value))
+		}
+	}
+	if len(c.ScrubFields) > 0 {
+		clientOpts = append(clientOpts, WithScrubFields(c.ScrubFields...))
+	}
+	if len(c.ScrubHeaders) > 0 {
+		clientOpts = append(clientOpts, WithScrubHeaders(c.ScrubHeaders...))
+	}
+	if c.Async {
+		clientOpts = append(clientOpts, WithAsync(c.AsyncBufferSize))
+	}
+	if c.Levels != nil {
+		hookOpts = append(hookOpts, WithLevels(c.Levels...))
+	}
+	if len(c.IgnoredErrors) > 0 {
+		hookOpts = append(hookOpts, WithIgnoredErrors(c.IgnoredErrors...))
+	}
+	if c.Custom != nil {
+		hookOpts = append(hookOpts, WithCustom(c.Custom))
+	}
+
+	h := NewHook(c.Token, c.Environment, append(clientOpts, hookOpts...)...)
+	own := h.Client
+	for _, o := range opts {
+		o(h)
+	}
+	if h.Client != own && len(clientOpts) > 0 {
+		return nil, errConfigWithClient
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
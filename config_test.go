@@ -0,0 +1,72 @@
+package rollrus
+
+import (
+	"io"
+	"testing"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewHookFromConfig(t *testing.T) {
+	h, err := NewHookFromConfig(Config{
+		Token:         "some-token",
+		Environment:   "production",
+		CodeVersion:   "abc123",
+		ServerHost:    "web-1",
+		Levels:        []logrus.Level{logrus.WarnLevel},
+		ScrubFields:   []string{"api_key"},
+		IgnoredErrors: []error{io.EOF},
+		Custom:        map[string]interface{}{"region": "eu"},
+		Async:         true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if h.Client.Token() != "some-token" || h.Client.Environment() != "production" {
+		t.Errorf("unexpected token or environment %q, %q", h.Client.Token(), h.Client.Environment())
+	}
+	if h.Client.CodeVersion() != "abc123" || h.Client.ServerHost() != "web-1" {
+		t.Errorf("unexpected code version or server host %q, %q", h.Client.CodeVersion(), h.Client.ServerHost())
+	}
+	if levels := h.Levels(); len(levels) != 1 || levels[0] != logrus.WarnLevel {
+		t.Errorf("unexpected levels %v", levels)
+	}
+	if h.scrubFields == nil || !h.scrubFields.MatchString("api_key") {
+		t.Error("expected the scrub fields to be configured")
+	}
+	if len(h.ignoredErrors) != 1 || h.extras["region"] != "eu" {
+		t.Errorf("expected the ignored errors and custom data, got %v and %v", h.ignoredErrors, h.extras)
+	}
+	if _, ok := h.Client.Transport.(*transport).Transport.(*rollbar.AsyncTransport); !ok {
+		t.Error("expected an async transport")
+	}
+}
+
+func TestNewHookFromConfigInvalid(t *testing.T) {
+	if _, err := NewHookFromConfig(Config{Environment: "production"}); err == nil {
+		t.Error("expected a missing token to be rejected")
+	}
+	cfg := Config{Token: "some-token", Environment: "production", Levels: []logrus.Level{}}
+	if _, err := NewHookFromConfig(cfg); err == nil {
+		t.Error("expected an empty list of levels to be rejected")
+	}
+}
+
+func TestNewHookFromConfigWithClient(t *testing.T) {
+	c := rollbar.NewSync("some-token", "production", "", "", "")
+	cfg := Config{Token: "some-token", Environment: "production", Endpoint: "https://rollbar.example.com/"}
+	if _, err := NewHookFromConfig(cfg, WithClient(c)); err != errConfigWithClient {
+		t.Errorf("expected client settings to be rejected with WithClient, got %v", err)
+	}
+
+	cfg = Config{Token: "some-token", Environment: "production", Custom: map[string]interface{}{"region": "eu"}}
+	h, err := NewHookFromConfig(cfg, WithClient(c))
+	if err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if h.Client != c || h.extras["region"] != "eu" {
+		t.Errorf("expected the client and the custom data to be used, got %v and %v", h.Client, h.extras)
+	}
+}
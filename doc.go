@@ -10,9 +10,18 @@ package rollrus
 // Custom uses are supported by creating a new Hook (via NewHook) and
 // registering it with your logrus Logger of choice.
 //
+// All fields of an entry are sent to Rollbar as extras. logrus has no logger
+// wide fields, so to attach global context (such as a service name) create a
+// base entry with logger.WithFields and derive all other entries from it.
+//
+// An entry can carry the *http.Request it was logged for in the
+// rollbar_request field, which is then reported as the request of the item
+// instead of as an extra. Authorization and cookie headers are scrubbed.
+//
 // The levels can be customized with the WithLevels OptionFunc.
 //
 // Specific errors can be ignored with the WithIgnoredErrors OptionFunc. This is
-// useful for ignoring errors such as context.Canceled.
+// useful for ignoring errors such as context.Canceled. WithIgnoreContextErrors
+// ignores both context.Canceled and context.DeadlineExceeded.
 //
 // See the Examples in the tests for more usage.
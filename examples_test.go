@@ -3,7 +3,8 @@ package rollrus
 import "github.com/sirupsen/logrus"
 
 func ExampleSetupLogging() {
-	SetupLogging("some-long-token", "staging")
+	hook := SetupLogging("some-long-token", "staging")
+	defer hook.Close()
 
 	// This will not be reported to Rollbar
 	logrus.Info("OHAI")
@@ -0,0 +1,84 @@
+package rollrus
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+// fanOut sends a copy of the report to each client of WithAdditionalClients,
+// concurrently with each other and with the hook's own client. The returned
+// function waits for the copies to be sent and returns the first error.
+// Batched reports are queued once per client instead.
+func (r *Hook) fanOut(entry *logrus.Entry, severity string, cause error, req *http.Request, o *occurrence,
+	m map[string]interface{}) func() error {
+	if len(r.additionalClients) == 0 {
+		return func() error { return nil }
+	}
+
+	level := entry.Level
+	fatal := level == logrus.FatalLevel || level == logrus.PanicLevel
+	var msg string // reported instead of the error, if not empty
+	switch {
+	case level == logrus.WarnLevel && r.omitWarningStack:
+		msg = cause.Error()
+	case level == logrus.InfoLevel || level == logrus.DebugLevel || level == logrus.TraceLevel:
+		msg = entry.Message
+	}
+	stack := r.errorStack(cause)
+	if _, ok := cause.(rollbar.CauseStacker); !ok && msg == "" && stack == nil {
+		// the copies are sent from other goroutines, so build the stack of
+		// the logging call here, one frame further down than report.
+		stack = rollbar.BuildStack(framesToSkip(4) - 1)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(r.additionalClients))
+	for _, c := range r.additionalClients {
+		oc := *o
+		oc.stack, oc.err = stack, nil
+		mc := copyExtras(m)
+
+		if r.batch != nil && !fatal {
+			it := &batchedItem{severity: severity, message: msg, request: req, occurrence: &oc, extras: mc, client: c}
+			if msg == "" {
+				it.err = cause
+			}
+			r.batch.add(it)
+			continue
+		}
+
+		wg.Add(1)
+		go func(c *rollbar.Client) {
+			defer wg.Done()
+			r.attachOccurrence(c, mc, &oc)
+			switch {
+			case msg != "" && req != nil:
+				c.RequestMessageWithExtras(severity, req, msg, mc)
+			case msg != "":
+				c.MessageWithExtras(severity, msg, mc)
+			case req != nil:
+				c.RequestErrorWithStackSkipWithExtras(severity, req, cause, 0, mc)
+			default:
+				c.ErrorWithStackSkipWithExtras(severity, cause, 0, mc)
+			}
+			if fatal {
+				c.Wait()
+			}
+			errs <- oc.err
+		}(c)
+	}
+
+	return func() error {
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
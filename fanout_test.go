@@ -0,0 +1,63 @@
+package rollrus
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithAdditionalClients(t *testing.T) {
+	platform := rollbar.NewSync("", "platform", "", "", "")
+	h := NewHook("", "testing", WithAdditionalClients(platform, nil))
+	ft := withFakeTransport(h, &fakeTransport{})
+	pt := &fakeTransport{SyncTransport: rollbar.NewSyncTransport("", "")}
+	platform.Transport.(*transport).Transport = pt
+
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+	l.WithError(io.EOF).Error("This is a test")
+	l.Info("not reported")
+
+	if len(ft.sent) != 1 || len(pt.sent) != 1 {
+		t.Fatalf("expected one item for each client, got %d and %d", len(ft.sent), len(pt.sent))
+	}
+	data := ft.sent[0]["data"].(map[string]interface{})
+	mirrored := pt.sent[0]["data"].(map[string]interface{})
+	if mirrored["environment"] != "platform" {
+		t.Errorf("expected the environment of the additional client, got %v", mirrored["environment"])
+	}
+	if data["uuid"] != mirrored["uuid"] {
+		t.Errorf("expected both items to share the uuid, got %v and %v", data["uuid"], mirrored["uuid"])
+	}
+	frames := traceChain(data)[0]["frames"].(rollbar.Stack)
+	if got := traceChain(mirrored)[0]["frames"].(rollbar.Stack); !reflect.DeepEqual(got, frames) {
+		t.Errorf("expected the stack of the logging call, got %v, wanted %v", got, frames)
+	}
+	if s := h.Stats(); s.Reported != 2 {
+		t.Errorf("expected both items to be counted, got %+v", s)
+	}
+}
+
+func TestWithAdditionalClientsPropagatesErrors(t *testing.T) {
+	platform := rollbar.NewSync("", "platform", "", "", "")
+	h := NewHook("", "testing", WithAdditionalClients(platform), WithPropagateErrors())
+	withFakeTransport(h, &fakeTransport{})
+	platform.Transport.(*transport).Transport = &fakeTransport{
+		SyncTransport: rollbar.NewSyncTransport("", ""),
+		err:           rollbar.ErrHTTPError(http.StatusForbidden),
+		failures:      1,
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != rollbar.ErrHTTPError(http.StatusForbidden) {
+		t.Fatalf("expected the error of the additional client, got %v", err)
+	}
+}
@@ -1,9 +1,20 @@
 package rollrus
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/rollbar/rollbar-go"
@@ -12,107 +23,1137 @@ import (
 
 var _ logrus.Hook = &Hook{} //assert that *Hook is a logrus.Hook
 
+var errNoClient = errors.New("rollrus: hook has no rollbar client")
+
+// ErrConcurrencyLimit is passed to the WithOnError callback when a report is
+// dropped because of WithConcurrencyLimit.
+var ErrConcurrencyLimit = errors.New("rollrus: too many reports in flight, report dropped")
+
+// ErrRateLimited is passed to the WithOnError callback when a report is
+// dropped because of WithItemsPerMinuteLimit.
+var ErrRateLimited = errors.New("rollrus: items per minute limit reached, report dropped")
+
 // Hook is a wrapper for the Rollbar Client and is usable as a logrus.Hook.
 type Hook struct {
+	counters counters
+	labels   labelCounters
+
 	*rollbar.Client
 	triggers        []logrus.Level
 	ignoredErrors   []error
-	ignoreErrorFunc func(error) bool
-	ignoreFunc      func(error, map[string]interface{}) bool
+	ignoreErrorFunc func(ReportContext) bool
+	countedIgnore   func(ReportContext) (bool, string)
+	ignoreFunc      func(ReportContext) bool
+	skipIf          func(*logrus.Entry) bool
+	tags            []string
+	dynamicMinLevel func() logrus.Level
+	observeLevels   []logrus.Level
+	levelFilter     func(logrus.Level) bool
+	errorTypeLevels []errorTypeLevel
+	sentinelGroups  []sentinelGroup
+	groupByFields   []string
+
+	ignoreContextErrors bool
+
+	retryAttempts int
+	retryBackoff  time.Duration
+	onError       func(error)
+	errorHandler  func(*logrus.Entry, error)
+
+	propagateErrors bool
+
+	skipOnCanceledContext bool
+	batch                 *batcher
+	shutdownTimeout       time.Duration
+	httpClient            *http.Client
+	stackExtractor        func(error) []runtime.Frame
+	clock                 Clock
+	callerInfo            bool
+	fieldFormatter        func(string, interface{}) (interface{}, bool)
+	keyRenames            []keyRename
+	fieldAllowlist        map[string]bool
+	omitWarningStack      bool
+	extras                map[string]interface{}
+	framework             string
+	serverBranch          string
+	redactParams          map[string]bool
+	scrubFields           *regexp.Regexp
+	itemCustomizer        func(logrus.Level, error, map[string]interface{}) map[string]interface{}
+	projectRoutes         map[string]*rollbar.Client
+	additionalClients     []*rollbar.Client
+	levelTokens           map[logrus.Level]string
+	tokenRouter           func(*logrus.Entry) string
+	projectField          string
+	envSuffixField        string
+	envSuffixSep          string
+	causeField            string
+	reports               chan<- Report
+	panicStackDepth       int
+	collapseFrames        bool
+	source                *sourceContext
+	titleTemplate         *template.Template
+	personFunc            func(*logrus.Entry) (id, username, email string, extra map[string]interface{})
+	diagnostics           io.Writer
+	logger                logrus.FieldLogger
+
+	// dryRun receives the reports instead of Rollbar, see WithDryRun.
+	dryRun   io.Writer
+	dryRunMu sync.Mutex
+
+	// limiter limits the number of reports per minute, see
+	// WithItemsPerMinuteLimit.
+	limiter *rateLimiter
+
+	// sem limits the number of reports in flight, see WithConcurrencyLimit.
+	sem     chan struct{}
+	semWait time.Duration
+
+	// omitSyntheticFields disables adding the time and msg extras.
+	omitSyntheticFields bool
+	// maxMessageLength of the msg extra, see WithMaxMessageLength.
+	maxMessageLength int
+
+	// dropIfNoError skips entries without an error field, see WithDropIfNoError.
+	dropIfNoError bool
+
+	// triggersSetBy is the name of the OptionFunc that last set triggers.
+	triggersSetBy string
+	// triggersConflict describes the last level options that overrode each
+	// other, for Validate.
+	triggersConflict string
+
+	// only used for tests to verify whether or not a report happened. It is
+	// set once so that concurrent reports don't race on it.
+	reported     bool
+	reportedOnce sync.Once
+
+	// telemetry holds recently observed entries, see Observe.
+	telemetry eventRing
+
+	// recentLogs holds the last recentLogsSize entries that weren't reported,
+	// see WithRecentLogs.
+	recentLogs     eventRing
+	recentLogsSize int
+
+	nilClientOnce sync.Once
+
+	// levelsMu guards triggers and levelsSet, which SetLevels changes while
+	// the hook is in use.
+	levelsMu         sync.RWMutex
+	levelsSet        bool
+	adjustableLevels bool
+
+	// disabled is set to 1 by Disable.
+	disabled int32
+	// envDisabled is set to 1 while the environment of the client isn't one
+	// of enabledEnvs, see WithEnabledEnvironments.
+	envDisabled int32
+	enabledEnvs map[string]bool
+
+	// clientMu is held for writing while the credentials of the client are
+	// changed, see SetToken, and for reading while reports are sent. Clones
+	// use the one of their origin, see clientLock.
+	clientMu sync.RWMutex
+	origin   *Hook
+
+	// tokenClients are the clients created for WithLevelTokens and
+	// WithTokenRouter.
+	tokenClients tokenClients
+}
+
+// ReportContext describes an entry that is about to be reported. It is passed
+// to the callbacks that decide what happens to a report.
+type ReportContext struct {
+	// Level of the entry.
+	Level logrus.Level
+	// Err is the cause of the error that will be reported.
+	Err error
+	// Message of the entry.
+	Message string
+	// Extras are the converted fields that will be reported.
+	Extras map[string]interface{}
+	// Entry is the logrus entry itself.
+	Entry *logrus.Entry
+}
 
-	// only used for tests to verify whether or not a report happened.
-	reported bool
+func newReportContext(entry *logrus.Entry, cause error, m map[string]interface{}) ReportContext {
+	return ReportContext{
+		Level:   entry.Level,
+		Err:     cause,
+		Message: entry.Message,
+		Extras:  m,
+		Entry:   entry,
+	}
 }
 
 // NewHookForLevels provided by the caller. Otherwise works like NewHook.
 func NewHookForLevels(token string, env string, levels []logrus.Level) *Hook {
-	return &Hook{
+	h := &Hook{
 		Client:          rollbar.NewSync(token, env, "", "", ""),
 		triggers:        levels,
 		ignoredErrors:   make([]error, 0),
-		ignoreErrorFunc: func(error) bool { return false },
-		ignoreFunc:      func(error, map[string]interface{}) bool { return false },
+		ignoreErrorFunc: func(ReportContext) bool { return false },
+		ignoreFunc:      func(ReportContext) bool { return false },
 	}
+	h.Client.Transport = newTransport(h, h.Client.Transport)
+	h.Client.SetScrubHeaders(defaultScrubHeaders)
+
+	return h
 }
 
 // Levels returns the logrus log.Levels that this hook handles
 func (r *Hook) Levels() []logrus.Level {
+	if r.dynamicMinLevel != nil || r.recentLogsSize > 0 || r.adjustableLevels {
+		// logrus caches the levels when the hook is added, so let all of them
+		// through and filter in Fire instead.
+		return logrus.AllLevels
+	}
+	if r.observeLevels != nil {
+		var levels []logrus.Level
+		for _, l := range logrus.AllLevels {
+			if containsLevel(r.observeLevels, l) || containsLevel(r.triggerLevels(), l) {
+				levels = append(levels, l)
+			}
+		}
+		return levels
+	}
+	return r.triggerLevels()
+}
+
+// triggerLevels returns the configured levels or the default ones.
+func (r *Hook) triggerLevels() []logrus.Level {
+	r.levelsMu.RLock()
+	defer r.levelsMu.RUnlock()
 	if r.triggers == nil {
 		return defaultTriggerLevels
 	}
 	return r.triggers
 }
 
+// Disable mutes the hook, for example during a maintenance window, without
+// removing it from the logger. Entries it would otherwise report are counted
+// as Suppressed in Stats. Disable and Enable are safe to call while the hook
+// is in use.
+func (r *Hook) Disable() {
+	atomic.StoreInt32(&r.disabled, 1)
+}
+
+// Enable makes a hook muted by Disable report again.
+func (r *Hook) Enable() {
+	atomic.StoreInt32(&r.disabled, 0)
+}
+
+// muted reports whether the hook was disabled by Disable or
+// WithEnabledEnvironments.
+func (r *Hook) muted() bool {
+	return atomic.LoadInt32(&r.disabled) != 0 || atomic.LoadInt32(&r.envDisabled) != 0
+}
+
+// SetLevels replaces the levels the hook reports on while it is in use, for
+// example to report warnings during an incident. logrus only asks a hook for
+// its levels when the hook is added, so entries of levels that weren't
+// reported before only reach the hook if it was created with
+// WithAdjustableLevels. Without levels the default ones are reported.
+func (r *Hook) SetLevels(levels ...logrus.Level) {
+	var copied []logrus.Level
+	if len(levels) > 0 {
+		copied = append(copied, levels...)
+	}
+
+	r.levelsMu.Lock()
+	defer r.levelsMu.Unlock()
+	r.triggers = copied
+	r.levelsSet = true
+}
+
+// SetMinLevel makes the hook report on min and all levels more severe than
+// it, see SetLevels.
+func (r *Hook) SetMinLevel(min logrus.Level) {
+	var levels []logrus.Level
+	for _, l := range logrus.AllLevels {
+		if l <= min {
+			levels = append(levels, l)
+		}
+	}
+	r.SetLevels(levels...)
+}
+
+// levelsChanged reports whether SetLevels was called, after which logrus may
+// pass entries of levels the hook no longer reports on.
+func (r *Hook) levelsChanged() bool {
+	r.levelsMu.RLock()
+	defer r.levelsMu.RUnlock()
+	return r.levelsSet
+}
+
+// levelEnabled reports whether an entry with the given level should be
+// reported. Levels() may return more levels than the hook reports on, in which
+// case the configured levels and the dynamic minimum level are checked here.
+// The level filter, if any, is always consulted.
+func (r *Hook) levelEnabled(level logrus.Level) bool {
+	if r.levelFilter != nil && !r.levelFilter(level) {
+		return false
+	}
+	if r.dynamicMinLevel == nil && r.observeLevels == nil && r.recentLogsSize == 0 &&
+		!r.adjustableLevels && !r.levelsChanged() {
+		return true
+	}
+	if r.dynamicMinLevel != nil && level > r.dynamicMinLevel() {
+		return false
+	}
+	return containsLevel(r.triggerLevels(), level)
+}
+
+func containsLevel(levels []logrus.Level, level logrus.Level) bool {
+	for _, l := range levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
 // Fire the hook. This is called by Logrus for entries that match the levels
 // returned by Levels().
 func (r *Hook) Fire(entry *logrus.Entry) error {
-	err := extractError(entry)
+	return r.fire(entry)
+}
+
+// Report runs err through the hook as if it was logged with the given level
+// and fields, for code that doesn't use logrus. The stack trace starts at the
+// caller of Report. Like logrus, it skips levels the hook doesn't handle, and
+// a nil err is not reported.
+func (r *Hook) Report(level logrus.Level, err error, fields map[string]interface{}) {
+	// logrus only fires the hook for the levels it returns
+	if err == nil || !containsLevel(r.Levels(), level) {
+		return
+	}
+	entry := &logrus.Entry{
+		Data:  make(logrus.Fields, len(fields)+1),
+		Time:  r.now(),
+		Level: level,
+	}
+	for k, v := range fields {
+		entry.Data[k] = v
+	}
+	entry.Data[logrus.ErrorKey] = err
+	entry.Message = err.Error()
+	_ = r.fire(entry)
+}
+
+// WillReport reports whether the hook would report the entry if it was
+// logged, so that expensive fields only need to be built for entries that
+// are. It runs the level checks and the checks for ignored errors, but not the
+// callbacks of WithIgnoreFunc and WithIgnoreReportFunc, which need the
+// converted fields, nor the limits on the number of reports. WillReport has no
+// side effects of its own and doesn't count the entry as ignored.
+func (r *Hook) WillReport(entry *logrus.Entry) bool {
+	// logrus only fires the hook for the levels it returns
+	if r.Client == nil || !containsLevel(r.Levels(), entry.Level) {
+		return false
+	}
+	skipped, _, _ := r.check(entry)
+	return skipped.reason == skipNone
+}
+
+// skipReason tells why an entry isn't reported.
+type skipReason int
+
+const (
+	skipNone skipReason = iota
+	// skipLevel entries have a level the hook doesn't report on.
+	skipLevel
+	// skipIgnored entries are counted as ignored.
+	skipIgnored
+	// skipCounted entries are counted as ignored by the label of a
+	// WithCountedIgnore rule.
+	skipCounted
+	// skipDiagnostic entries were logged by rollrus itself, see WithLogger.
+	skipDiagnostic
+	// skipDisabled entries are suppressed while the hook is disabled.
+	skipDisabled
+)
+
+// skip describes the outcome of check.
+type skip struct {
+	reason skipReason
+	label  string
+}
+
+// check decides whether the entry is reported, without side effects other
+// than those of the configured callbacks. Unless the entry is skipped, it
+// also returns the error to report and its cause.
+func (r *Hook) check(entry *logrus.Entry) (skip, error, error) {
+	if _, ok := entry.Data[diagnosticField]; ok {
+		return skip{reason: skipDiagnostic}, nil, nil
+	}
+
+	if r.skipIf != nil && r.skipIf(entry) {
+		return skip{reason: skipIgnored}, nil, nil
+	}
+
+	if !r.levelEnabled(entry.Level) {
+		return skip{reason: skipLevel}, nil, nil
+	}
+
+	if r.muted() {
+		return skip{reason: skipDisabled}, nil, nil
+	}
+
+	if r.skipOnCanceledContext && entry.Context != nil && entry.Context.Err() != nil {
+		return skip{reason: skipIgnored}, nil, nil
+	}
+
+	err := findError(entry)
+	if err == nil {
+		if r.dropIfNoError {
+			return skip{reason: skipIgnored}, nil, nil
+		}
+		err = errors.New(entry.Message)
+	}
 	cause := errorCause(err)
 	for _, ie := range r.ignoredErrors {
 		if ie == cause {
-			return nil
+			return skip{reason: skipIgnored}, nil, nil
 		}
 	}
 
-	if r.ignoreErrorFunc(cause) {
+	if r.ignoreContextErrors && (isContextError(err) || isContextError(cause)) {
+		return skip{reason: skipIgnored}, nil, nil
+	}
+
+	// the fields aren't converted yet, which is left to entries that pass
+	rc := newReportContext(entry, cause, nil)
+	if r.ignoreErrorFunc != nil && r.ignoreErrorFunc(rc) {
+		return skip{reason: skipIgnored}, nil, nil
+	}
+
+	if r.countedIgnore != nil {
+		if ignore, label := r.countedIgnore(rc); ignore {
+			return skip{reason: skipCounted, label: label}, nil, nil
+		}
+	}
+
+	return skip{}, err, cause
+}
+
+// fire does the work of Fire and Report, which must call it directly so that
+// the stack trace can be skipped to their caller.
+func (r *Hook) fire(entry *logrus.Entry) error {
+	if r.Client == nil {
+		r.warnNilClient()
+		return nil
+	}
+
+	skipped, err, cause := r.check(entry)
+	switch skipped.reason {
+	case skipLevel:
+		if containsLevel(r.observeLevels, entry.Level) {
+			r.Observe(entry)
+		}
+		if r.recentLogsSize > 0 {
+			r.recordRecentLog(entry)
+		}
+		return nil
+	case skipIgnored:
+		r.countIgnored()
+		return nil
+	case skipCounted:
+		r.countIgnoredLabel(skipped.label)
 		return nil
+	case skipDiagnostic:
+		return nil
+	case skipDisabled:
+		r.countSuppressed()
+		return nil
+	}
+
+	m := convertFieldsWith(entry.Data, r.fieldFormatter)
+	renameKeys(m, r.keyRenames)
+	if r.fieldAllowlist != nil {
+		for k := range m {
+			if !r.fieldAllowlist[k] {
+				delete(m, k)
+			}
+		}
+	}
+	if !r.omitSyntheticFields {
+		if _, exists := m["time"]; !exists {
+			m["time"] = r.entryTime(entry).Format(time.RFC3339)
+		}
+
+		if _, exists := m["msg"]; !exists && entry.Message != "" {
+			m["msg"] = truncate(entry.Message, r.messageLength())
+		}
+	}
+
+	if r.causeField != "" {
+		if _, exists := m[r.causeField]; !exists {
+			m[r.causeField] = rootCause(err).Error()
+		}
+	}
+
+	if r.recentLogsSize > 0 {
+		if logs := r.recentLogs.take(); logs != nil {
+			m["recent_logs"] = logs
+		}
+	}
+
+	for k, v := range r.extras {
+		if _, exists := m[k]; !exists {
+			m[k] = v
+		}
 	}
 
-	m := convertFields(entry.Data)
-	if _, exists := m["time"]; !exists {
-		m["time"] = entry.Time.Format(time.RFC3339)
+	delete(m, tagsField)
+	delete(m, levelField)
+	delete(m, severityField)
+	delete(m, uuidField)
+	delete(m, requestField)
+	delete(m, envField)
+	if r.projectRoutes != nil {
+		delete(m, r.projectField)
+	}
+	if tags := mergeTags(r.tags, entry.Data[tagsField]); len(tags) > 0 {
+		m["tags"] = tags
+	}
+
+	if r.redactParams != nil {
+		redactStrings(m, r.redactParams)
 	}
 
-	if _, exists := m["msg"]; !exists && entry.Message != "" {
-		m["msg"] = entry.Message
+	if r.scrubFields != nil {
+		scrubExtras(m, r.scrubFields)
 	}
 
-	if r.ignoreFunc(cause, m) {
+	if r.ignoreFunc != nil && r.ignoreFunc(newReportContext(entry, cause, m)) {
+		r.countIgnored()
 		return nil
 	}
 
-	r.report(entry, err, m)
+	if r.itemCustomizer != nil {
+		for k, v := range r.itemCustomizer(entry.Level, cause, m) {
+			m[k] = v
+		}
+	}
 
+	if err := r.report(entry, err, m); err != nil && r.propagateErrors {
+		return err
+	}
 	return nil
 }
 
-func (r *Hook) report(entry *logrus.Entry, cause error, m map[string]interface{}) {
+// report sends the entry to Rollbar. It returns the error of sending it, if
+// known by the time it returns, or why it was dropped.
+func (r *Hook) report(entry *logrus.Entry, cause error, m map[string]interface{}) error {
+	if r.Client == nil {
+		r.warnNilClient()
+		return errNoClient
+	}
+	r.clientLock().RLock()
+	defer r.clientLock().RUnlock()
+
 	level := entry.Level
+	severity := r.severity(entry, cause)
+	o := r.newOccurrence(entry)
+	if o.fingerprint = r.sentinelGroup(cause); o.fingerprint == "" {
+		o.fingerprint = r.fieldsFingerprint(entry, cause)
+	}
+	o.title = r.renderTitle(entry, cause)
+	req, _ := entry.Data[requestField].(*http.Request)
+	c := r.client(entry)
 
-	r.reported = true
+	if r.callerInfo {
+		m["caller"] = callerFunction(3)
+		m["goroutine"] = goroutineID()
+	}
 
+	if r.limiter != nil && level != logrus.FatalLevel && level != logrus.PanicLevel {
+		ok, dropped := r.limiter.allow(r.now())
+		if !ok {
+			r.fail(ErrRateLimited)
+			return ErrRateLimited
+		}
+		if dropped > 0 {
+			m["dropped_due_to_rate_limit"] = dropped
+		}
+	}
+
+	if !r.acquire(level) {
+		r.fail(ErrConcurrencyLimit)
+		return ErrConcurrencyLimit
+	}
+	defer r.release()
+
+	r.reportedOnce.Do(func() { r.reported = true })
+	r.mirror(entry, cause, m)
+
+	if r.dryRun != nil {
+		r.writeDryRun(entry, severity, cause, o, m)
+		return nil
+	}
+
+	wait := r.fanOut(entry, severity, cause, req, o, m)
 	switch {
 	case level == logrus.FatalLevel || level == logrus.PanicLevel:
-		skip := framesToSkip(2)
-		r.Client.ErrorWithStackSkipWithExtras(rollbar.CRIT, cause, skip, m)
-		r.Client.Wait()
-	case level == logrus.ErrorLevel:
-		skip := framesToSkip(2)
-		r.Client.ErrorWithStackSkipWithExtras(rollbar.ERR, cause, skip, m)
-	case level == logrus.WarnLevel:
-		skip := framesToSkip(2)
-		r.Client.ErrorWithStackSkipWithExtras(rollbar.WARN, cause, skip, m)
-	case level == logrus.InfoLevel:
-		r.Client.MessageWithExtras(rollbar.INFO, entry.Message, m)
-	case level == logrus.DebugLevel:
-		r.Client.MessageWithExtras(rollbar.DEBUG, entry.Message, m)
-	case level == logrus.TraceLevel:
-		r.Client.MessageWithExtras(rollbar.DEBUG, entry.Message, m)
+		o.stack = r.errorStack(cause)
+		r.attachOccurrence(c, m, o)
+		skip := framesToSkip(3)
+		if req != nil {
+			c.RequestErrorWithStackSkipWithExtras(severity, req, cause, skip, m)
+		} else {
+			c.ErrorWithStackSkipWithExtras(severity, cause, skip, m)
+		}
+		if r.batch != nil {
+			// logrus exits right after a fatal entry
+			r.batch.flushLocked()
+		}
+		c.Wait()
+	case level == logrus.WarnLevel && r.omitWarningStack:
+		r.sendMessage(c, severity, cause.Error(), req, o, m)
+	case r.batch != nil && (level == logrus.ErrorLevel || level == logrus.WarnLevel):
+		skip := framesToSkip(3)
+		// BuildStack is called directly from here instead of from deep within
+		// the rollbar client, which needs one frame less to be skipped.
+		if o.stack = r.errorStack(cause); o.stack == nil {
+			o.stack = rollbar.BuildStack(skip - 1)
+		}
+		r.batch.add(&batchedItem{severity: severity, err: cause, request: req, occurrence: o, extras: m, client: c})
+	case level == logrus.ErrorLevel || level == logrus.WarnLevel:
+		o.stack = r.errorStack(cause)
+		r.attachOccurrence(c, m, o)
+		skip := framesToSkip(3)
+		if req != nil {
+			c.RequestErrorWithStackSkipWithExtras(severity, req, cause, skip, m)
+		} else {
+			c.ErrorWithStackSkipWithExtras(severity, cause, skip, m)
+		}
+	case level == logrus.InfoLevel || level == logrus.DebugLevel || level == logrus.TraceLevel:
+		r.sendMessage(c, severity, entry.Message, req, o, m)
+	}
+
+	err := wait()
+	if r.batch != nil && level != logrus.FatalLevel && level != logrus.PanicLevel {
+		// the batcher sends the item later
+		return nil
+	}
+	// the transport has sent the item by now
+	if o.err != nil {
+		return o.err
+	}
+	return err
+}
+
+// Report is a copy of a report sent to the channel given to
+// WithReportChannel.
+type Report struct {
+	// Level of the entry.
+	Level logrus.Level
+	// Err is the error that was reported.
+	Err error
+	// Extras are the extras reported with the error.
+	Extras map[string]interface{}
+	// Time the entry was logged at.
+	Time time.Time
+}
+
+// mirror sends a copy of the report to the WithReportChannel channel, if any,
+// unless the channel is full.
+func (r *Hook) mirror(entry *logrus.Entry, cause error, m map[string]interface{}) {
+	if r.reports == nil {
+		return
+	}
+
+	extras := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		extras[k] = v
+	}
+	select {
+	case r.reports <- Report{Level: entry.Level, Err: cause, Extras: extras, Time: r.entryTime(entry)}:
+	default:
+	}
+}
+
+// writeDryRun writes the report to the WithDryRun writer as indented JSON. The
+// occurrence is applied like the transport would, so the output shows the
+// redacted messages, the title and the environment that would be sent.
+func (r *Hook) writeDryRun(entry *logrus.Entry, severity string, cause error, o *occurrence,
+	m map[string]interface{}) {
+	report := map[string]interface{}{
+		"level":     severity,
+		"error":     o.rewriteString(cause.Error()),
+		"message":   o.rewriteString(entry.Message),
+		"timestamp": o.timestamp.Format(time.RFC3339),
+		"extras":    m,
+	}
+	if o.fingerprint != "" {
+		report["fingerprint"] = o.fingerprint
+	}
+	if o.title != "" {
+		report["title"] = o.rewriteString(o.title)
+	}
+	if o.environment != "" {
+		report["environment"] = o.environment
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		r.warnf("dry run: %v", err)
+		return
+	}
+
+	r.dryRunMu.Lock()
+	defer r.dryRunMu.Unlock()
+	if _, err := r.dryRun.Write(append(b, '\n')); err != nil {
+		r.warnf("dry run: %v", err)
+	}
+}
+
+// isContextError reports whether err is or wraps context.Canceled or
+// context.DeadlineExceeded.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// acquire a slot for a report when the number of reports in flight is
+// limited. Fatal and Panic entries always wait for a slot, others wait at most
+// semWait.
+func (r *Hook) acquire(level logrus.Level) bool {
+	if r.sem == nil {
+		return true
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	if level == logrus.FatalLevel || level == logrus.PanicLevel {
+		r.sem <- struct{}{}
+		return true
+	}
+	if r.semWait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(r.semWait)
+	defer timer.Stop()
+	select {
+	case r.sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// release a slot acquired with acquire.
+func (r *Hook) release() {
+	if r.sem != nil {
+		<-r.sem
+	}
+}
+
+// sendMessage reports msg without a stack trace.
+func (r *Hook) sendMessage(c *rollbar.Client, severity, msg string, req *http.Request, o *occurrence,
+	m map[string]interface{}) {
+	if r.batch != nil {
+		r.batch.add(&batchedItem{severity: severity, message: msg, request: req, occurrence: o, extras: m, client: c})
+		return
+	}
+	r.attachOccurrence(c, m, o)
+	if req != nil {
+		c.RequestMessageWithExtras(severity, req, msg, m)
+		return
+	}
+	c.MessageWithExtras(severity, msg, m)
+}
+
+// defaultMaxMessageLength is the length the msg extra is truncated to by
+// default.
+const defaultMaxMessageLength = 1024
+
+// messageLength returns the length the msg extra is truncated to, or a
+// negative number if it isn't.
+func (r *Hook) messageLength() int {
+	if r.maxMessageLength == 0 {
+		return defaultMaxMessageLength
+	}
+	return r.maxMessageLength
+}
+
+// truncate s to n characters, marking it with an ellipsis if it was longer.
+// Negative lengths leave s alone.
+func truncate(s string, n int) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j] + "…"
+		}
+		i++
+	}
+	return s
+}
+
+// now returns the current time according to the hook's clock.
+func (r *Hook) now() time.Time {
+	return r.timer().Now()
+}
+
+// timer returns the hook's clock, or the wall clock if there is none.
+func (r *Hook) timer() Clock {
+	if r.clock == nil {
+		return wallClock{}
+	}
+	return r.clock
+}
+
+// entryTime returns the time the entry was logged at, or the current time for
+// entries that were never logged through a logrus.Logger.
+func (r *Hook) entryTime(entry *logrus.Entry) time.Time {
+	if entry.Time.IsZero() {
+		return r.now()
+	}
+	return entry.Time
+}
+
+// SetToken replaces the access token of the hook's client, for example when it
+// is rotated. It waits for the reports being sent to finish, so it is safe to
+// call while the hook is in use, but not from the callbacks of the hook. Items
+// already queued by an asynchronous client are sent with the old token first,
+// as its sender reads the token without taking the lock.
+func (r *Hook) SetToken(token string) {
+	if r.Client == nil {
+		r.warnNilClient()
+		return
+	}
+	r.clientLock().Lock()
+	defer r.clientLock().Unlock()
+	r.Client.Wait()
+	r.Client.SetToken(token)
+}
+
+// SetEnvironment replaces the environment of the hook's client, and of the
+// clients created for WithLevelTokens and WithTokenRouter, like SetToken
+// replaces the token.
+func (r *Hook) SetEnvironment(env string) {
+	if r.Client == nil {
+		r.warnNilClient()
+		return
+	}
+	r.clientLock().Lock()
+	defer r.clientLock().Unlock()
+	r.Client.SetEnvironment(env)
+	r.eachTokenClient(func(c *rollbar.Client) { c.SetEnvironment(env) })
+	r.checkEnvironment(env)
+}
+
+// checkEnvironment disables the hook unless env is one of the environments of
+// WithEnabledEnvironments, if any.
+func (r *Hook) checkEnvironment(env string) {
+	var disabled int32
+	if r.enabledEnvs != nil && !r.enabledEnvs[env] {
+		disabled = 1
+	}
+	atomic.StoreInt32(&r.envDisabled, disabled)
+}
+
+// client returns the client to report the entry with, see WithProjectRouter,
+// WithTokenRouter and WithLevelTokens.
+func (r *Hook) client(entry *logrus.Entry) *rollbar.Client {
+	if v, ok := entry.Data[r.projectField].(string); ok && r.projectRoutes != nil {
+		if c := r.projectRoutes[v]; c != nil {
+			return c
+		}
+	}
+	if token := r.entryToken(entry); token != "" {
+		return r.tokenClient(token)
 	}
+	return r.Client
+}
+
+// attachOccurrence adds the occurrence to the extras so that the transport can
+// apply it. Clients whose transport wasn't wrapped by rollrus, for example in
+// Hook literals, would send it as custom data, so it is left out for them.
+func (r *Hook) attachOccurrence(c *rollbar.Client, m map[string]interface{}, o *occurrence) {
+	if _, ok := c.Transport.(*transport); ok {
+		m[occurrenceKey] = o
+	}
+}
+
+// ErrShutdownTimeout is returned by Close when the reports weren't sent within
+// the timeout set with WithShutdownTimeout.
+var ErrShutdownTimeout = errors.New("rollrus: timed out waiting for reports to be sent")
+
+// Wait sends any batched reports and blocks until the items queued by the
+// hook's clients, including those of WithProjectRouter and
+// WithAdditionalClients, have been sent, or until the timeout set with
+// WithShutdownTimeout has passed. Unlike Close it leaves the hook usable.
+// Like Close it does nothing for a nil hook.
+func (r *Hook) Wait() {
+	if r == nil {
+		return
+	}
+	r.withinShutdownTimeout(func() {
+		if r.batch != nil {
+			r.batch.flush()
+		}
+		for _, c := range r.projectRoutes {
+			c.Wait()
+		}
+		for _, c := range r.additionalClients {
+			c.Wait()
+		}
+		r.eachTokenClient(func(c *rollbar.Client) { c.Wait() })
+		if r.Client != nil {
+			r.Client.Wait()
+		}
+	})
+}
+
+// Close sends any batched reports and closes the underlying client, waiting
+// for its queued items to be sent. It returns ErrShutdownTimeout if that takes
+// longer than the timeout set with WithShutdownTimeout. Closing a nil hook, as
+// returned by SetupLogging without a token, does nothing.
+func (r *Hook) Close() error {
+	if r == nil {
+		return nil
+	}
+	var err error
+	if !r.withinShutdownTimeout(func() {
+		if r.batch != nil {
+			r.batch.close()
+		}
+		if r.Client != nil {
+			err = r.Client.Close()
+		}
+		r.eachTokenClient(func(c *rollbar.Client) {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		})
+	}) {
+		return ErrShutdownTimeout
+	}
+	return err
+}
+
+// withinShutdownTimeout runs fn and reports whether it returned within the
+// shutdown timeout. Without a timeout it always waits for fn.
+func (r *Hook) withinShutdownTimeout(fn func()) bool {
+	if r.shutdownTimeout <= 0 {
+		fn()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	timer := time.NewTimer(r.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// levelSeverity returns the Rollbar severity for the entry. An entry can ask
+// to be reported as critical via the rollbar_level field, otherwise the
+// severity is derived from the logrus level.
+func levelSeverity(entry *logrus.Entry) string {
+	if v, ok := entry.Data[levelField].(string); ok && strings.EqualFold(v, rollbar.CRIT) {
+		return rollbar.CRIT
+	}
+	return levelSeverities[entry.Level]
+}
+
+// errorTypeLevel overrides the severity of errors of a type, see
+// WithLevelForErrorType.
+type errorTypeLevel struct {
+	typ      reflect.Type
+	severity string
+}
+
+// severity returns the Rollbar severity to report err with. A valid
+// rollbar_severity field always decides. Otherwise, unless the entry is
+// critical, the first WithLevelForErrorType rule matching err does.
+func (r *Hook) severity(entry *logrus.Entry, err error) string {
+	if v, ok := entry.Data[severityField].(string); ok && validSeverities[strings.ToLower(v)] {
+		return strings.ToLower(v)
+	}
+
+	severity := levelSeverity(entry)
+	if severity == rollbar.CRIT {
+		return severity
+	}
+	for _, l := range r.errorTypeLevels {
+		if errors.As(err, reflect.New(l.typ).Interface()) {
+			return l.severity
+		}
+	}
+	return severity
+}
+
+// sentinelGroup groups errors matching any of errs, see WithSentinelGroup.
+type sentinelGroup struct {
+	name string
+	errs []error
+}
+
+// sentinelGroup returns the name of the first sentinel group err belongs to,
+// or an empty string.
+func (r *Hook) sentinelGroup(err error) string {
+	for _, g := range r.sentinelGroups {
+		for _, target := range g.errs {
+			if errors.Is(err, target) {
+				return g.name
+			}
+		}
+	}
+	return ""
+}
+
+// TitleData is what the template given to WithMessageTemplate is executed
+// with.
+type TitleData struct {
+	// Fields of the entry.
+	Fields logrus.Fields
+	// Err that is reported.
+	Err error
+	// Level of the entry, like "error".
+	Level string
+	// Message of the entry.
+	Message string
+}
+
+// renderTitle returns the title rendered by the WithMessageTemplate template,
+// or an empty string to keep the default one.
+func (r *Hook) renderTitle(entry *logrus.Entry, err error) string {
+	if r.titleTemplate == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	data := TitleData{Fields: entry.Data, Err: err, Level: entry.Level.String(), Message: entry.Message}
+	if err := r.titleTemplate.Execute(&b, data); err != nil {
+		r.warnf("rendering the message template: %v", err)
+		return ""
+	}
+	return b.String()
+}
+
+// fieldsFingerprint returns the fingerprint made of the type of err and the
+// values of the WithGroupByFields fields, or an empty string when one of them
+// is missing.
+func (r *Hook) fieldsFingerprint(entry *logrus.Entry, err error) string {
+	if len(r.groupByFields) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(r.groupByFields)+1)
+	parts = append(parts, fmt.Sprintf("%T", err))
+	for _, k := range r.groupByFields {
+		v, ok := entry.Data[k]
+		if !ok {
+			return ""
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, "|")
+}
+
+// warnNilClient prints a warning to stderr the first time a Hook without a
+// Rollbar Client is asked to report something.
+func (r *Hook) warnNilClient() {
+	r.nilClientOnce.Do(func() {
+		r.warnf("hook has no rollbar client, not reporting")
+	})
+	r.fail(errNoClient)
+}
+
+// fail passes an internal rollrus failure to the WithLogger logger and the
+// WithOnError callback, if any.
+func (r *Hook) fail(err error) {
+	if r.logger != nil {
+		r.logger.WithField(diagnosticField, true).WithError(err).Warn("rollrus: report failed")
+	}
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+// warnf prints a rollrus diagnostic message to the WithLogger logger, the
+// diagnostic writer, or stderr if neither was set.
+func (r *Hook) warnf(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.WithField(diagnosticField, true).Warnf("rollrus: "+format, args...)
+		return
+	}
+	w := r.diagnostics
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "rollrus: "+format+"\n", args...)
+}
+
+// diagnosticField marks the entries rollrus logs to the WithLogger logger, so
+// that the hook doesn't report them if it is attached to the same logger.
+const diagnosticField = "rollrus_diagnostic"
+
+// fieldLogger is a rollbar.ClientLogger logging warnings to a
+// logrus.FieldLogger, see WithLogger.
+type fieldLogger struct {
+	l logrus.FieldLogger
+}
+
+func (l fieldLogger) Printf(format string, args ...interface{}) {
+	l.l.WithField(diagnosticField, true).Warnf(strings.TrimSuffix(format, "\n"), args...)
+}
+
+// writerLogger is a rollbar.ClientLogger writing to an io.Writer.
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l writerLogger) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(l.w, format, args...)
 }
 
 // convertFields converts from log.Fields to map[string]interface{} so that we can
 // report extra fields to Rollbar
 func convertFields(fields logrus.Fields) map[string]interface{} {
+	return convertFieldsWith(fields, nil)
+}
+
+// convertFieldsWith works like convertFields, but lets format render fields
+// first. Fields for which format returns false are converted as usual.
+func convertFieldsWith(fields logrus.Fields,
+	format func(key string, value interface{}) (interface{}, bool)) map[string]interface{} {
 	m := make(map[string]interface{})
 	for k, v := range fields {
+		if format != nil {
+			if f, ok := format(k, v); ok {
+				m[k] = f
+				continue
+			}
+		}
+
 		switch t := v.(type) {
 		case time.Time:
 			m[k] = t.Format(time.RFC3339)
 		case error:
 			m[k] = t.Error()
 		default:
-			if s, ok := v.(fmt.Stringer); ok {
+			if errs, ok := convertErrors(v); ok {
+				m[k] = errs
+			} else if s, ok := v.(fmt.Stringer); ok {
 				m[k] = s.String()
 			} else {
 				m[k] = fmt.Sprintf("%+v", t)
@@ -123,8 +1164,108 @@ func convertFields(fields logrus.Fields) map[string]interface{} {
 	return m
 }
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// convertErrors converts slices and maps of errors into slices and maps of
+// their messages, so that they are reported as JSON arrays and objects.
+func convertErrors(v interface{}) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if !rv.Type().Elem().Implements(errorType) {
+			return nil, false
+		}
+		msgs := make([]string, rv.Len())
+		for i := range msgs {
+			msgs[i] = errorMessage(rv.Index(i))
+		}
+		return msgs, true
+	case reflect.Map:
+		if !rv.Type().Elem().Implements(errorType) {
+			return nil, false
+		}
+		msgs := make(map[string]string, rv.Len())
+		for _, k := range rv.MapKeys() {
+			msgs[fmt.Sprint(k.Interface())] = errorMessage(rv.MapIndex(k))
+		}
+		return msgs, true
+	}
+	return nil, false
+}
+
+// errorMessage returns the message of the error held by v.
+func errorMessage(v reflect.Value) string {
+	if (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) && v.IsNil() {
+		return "<nil>"
+	}
+	return v.Interface().(error).Error()
+}
+
+// keyRename renames the from field to to, see WithFieldKeyRename.
+type keyRename struct {
+	from, to string
+}
+
+// renameKeys applies the renames at once, reading all the renamed fields
+// before writing any, so that keys can be swapped. When several renames have
+// the same target the last one wins.
+func renameKeys(m map[string]interface{}, renames []keyRename) {
+	values := make([]interface{}, len(renames))
+	found := make([]bool, len(renames))
+	for i, k := range renames {
+		values[i], found[i] = m[k.from]
+	}
+	for i, k := range renames {
+		if found[i] {
+			delete(m, k.from)
+		}
+	}
+	for i, k := range renames {
+		if found[i] {
+			m[k.to] = values[i]
+		}
+	}
+}
+
+// mergeTags returns the hook's tags followed by any tags provided via the
+// rollbar_tags field, without duplicates. The field may either be a []string or
+// a comma separated string.
+func mergeTags(tags []string, field interface{}) []string {
+	var extra []string
+	switch t := field.(type) {
+	case []string:
+		extra = t
+	case string:
+		extra = strings.Split(t, ",")
+	}
+
+	merged := make([]string, 0, len(tags)+len(extra))
+	seen := make(map[string]bool, len(tags)+len(extra))
+	for _, tag := range append(append([]string{}, tags...), extra...) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		merged = append(merged, tag)
+	}
+
+	return merged
+}
+
 // extractError attempts to extract an error from a well known field, err or error
 func extractError(entry *logrus.Entry) error {
+	if err := findError(entry); err != nil {
+		return err
+	}
+
+	// when no error found, default to the logged message, verbatim.
+	return errors.New(entry.Message)
+}
+
+// findError returns the error from the first well known field holding one, or
+// nil if there is none.
+func findError(entry *logrus.Entry) error {
 	for _, f := range wellKnownErrorFields {
 		e, ok := entry.Data[f]
 		if !ok {
@@ -138,10 +1279,16 @@ func extractError(entry *logrus.Entry) error {
 		return err
 	}
 
-	// when no error found, default to the logged message.
-	return fmt.Errorf(entry.Message)
+	return nil
 }
 
+// callerFunc is used by framesToSkip to inspect the call stack. It is a
+// variable so that tests can provide synthetic frames.
+var callerFunc = runtime.Caller
+
+// maxLogrusFrames is the most frames framesToSkip expects to be in logrus.
+const maxLogrusFrames = 32
+
 // framesToSkip returns the number of caller frames to skip
 // to get a stack trace that excludes rollrus and logrus.
 func framesToSkip(rollrusSkip int) int {
@@ -151,9 +1298,10 @@ func framesToSkip(rollrusSkip int) int {
 	// to get out of logrus, the amount can vary
 	// depending on how the user calls the log functions
 	// figure it out dynamically by skipping until
-	// we're out of the logrus package
-	for i := skip; ; i++ {
-		_, file, _, ok := runtime.Caller(i)
+	// we're out of the logrus package. Give up after maxLogrusFrames and keep
+	// the logrus frames instead of walking pathologically deep stacks.
+	for i := skip; i < skip+maxLogrusFrames; i++ {
+		_, file, _, ok := callerFunc(i)
 		if !ok || !strings.Contains(file, "github.com/sirupsen/logrus") {
 			skip = i
 			break
@@ -165,6 +1313,31 @@ func framesToSkip(rollrusSkip int) int {
 	return skip + 2 - 1
 }
 
+// maxUnwrapDepth limits how many times rootCause unwraps an error, which also
+// ends cyclic chains.
+const maxUnwrapDepth = 100
+
+// rootCause returns the deepest error in the chain of err according to
+// errors.Unwrap. Errors that only have a Cause method, like those of older
+// github.com/pkg/errors versions, are followed through that.
+func rootCause(err error) error {
+	type causer interface {
+		Cause() error
+	}
+
+	for i := 0; i < maxUnwrapDepth; i++ {
+		next := errors.Unwrap(err)
+		if c, ok := err.(causer); ok && next == nil {
+			next = c.Cause()
+		}
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	return err
+}
+
 func errorCause(err error) error {
 	type causer interface {
 		Cause() error
@@ -1,11 +1,18 @@
 package rollrus
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -79,6 +86,46 @@ func TestTimeConversion(t *testing.T) {
 	}
 }
 
+func TestErrorCollectionConversion(t *testing.T) {
+	i := make(logrus.Fields)
+	i["slice"] = []error{io.EOF, nil, fmt.Errorf("This is an error")}
+	i["map"] = map[string]error{"a": io.EOF}
+
+	r := convertFields(i)
+
+	if expected := []string{"EOF", "<nil>", "This is an error"}; !reflect.DeepEqual(r["slice"], expected) {
+		t.Fatalf("Expected slice to equal %v, but instead it is: %v", expected, r["slice"])
+	}
+	if expected := map[string]string{"a": "EOF"}; !reflect.DeepEqual(r["map"], expected) {
+		t.Fatalf("Expected map to equal %v, but instead it is: %v", expected, r["map"])
+	}
+}
+
+type stringerError struct{}
+
+func (stringerError) Error() string  { return "error" }
+func (stringerError) String() string { return "string" }
+
+func TestConversionWithFormatter(t *testing.T) {
+	i := make(logrus.Fields)
+	i["test"] = stringerError{}
+	i["other"] = stringerError{}
+
+	r := convertFieldsWith(i, func(key string, value interface{}) (interface{}, bool) {
+		if s, ok := value.(fmt.Stringer); ok && key == "test" {
+			return s.String(), true
+		}
+		return nil, false
+	})
+
+	if r["test"] != "string" {
+		t.Fatal("Expected value to be formatted by the formatter, but instead it is: ", r["test"])
+	}
+	if r["other"] != "error" {
+		t.Fatal("Expected value to be the error message, but instead it is: ", r["other"])
+	}
+}
+
 func TestExtractError(t *testing.T) {
 	entry := logrus.NewEntry(nil)
 	entry.Data["err"] = fmt.Errorf("foo bar baz")
@@ -131,6 +178,28 @@ func TestExtractErrorDefault(t *testing.T) {
 	}
 }
 
+func TestExtractErrorDefaultKeepsMessageVerbatim(t *testing.T) {
+	var got map[string]interface{}
+	h := NewHook("", "testing", WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+		got = m
+		return true
+	}))
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "100% done"
+
+	if cause := extractError(entry); cause.Error() != entry.Message {
+		t.Fatalf("Expected error as string to be %q, but was instead: %q", entry.Message, cause)
+	}
+
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if got["msg"] != entry.Message {
+		t.Fatalf("Expected msg to be %q, but was instead: %v", entry.Message, got["msg"])
+	}
+}
+
 func TestExtractErrorFromStackTracer(t *testing.T) {
 	entry := logrus.NewEntry(nil)
 	entry.Data["err"] = errors.Errorf("foo bar baz")
@@ -180,6 +249,19 @@ func TestWithMinLevelFatal(t *testing.T) {
 	}
 }
 
+func TestWithBlocklistLevels(t *testing.T) {
+	h := NewHook("", "testing", WithBlocklistLevels(logrus.InfoLevel, logrus.DebugLevel, logrus.TraceLevel))
+	expectedLevels := []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.WarnLevel,
+	}
+	if !reflect.DeepEqual(h.Levels(), expectedLevels) {
+		t.Fatal("Expected Levels() to return all levels except Info, Debug and Trace")
+	}
+}
+
 func TestLoggingBelowTheMinimumLevelDoesNotFire(t *testing.T) {
 	h := NewHook("", "testing", WithMinLevel(logrus.FatalLevel))
 	l := logrus.New()
@@ -408,3 +490,1605 @@ func TestDynamicFrameSkipping(t *testing.T) {
 		t.Fatalf("expected frames to skip to be 2, got %d", skip)
 	}
 }
+
+func TestFireWithoutClient(t *testing.T) {
+	h := &Hook{}
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	entry.Level = logrus.ErrorLevel
+
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+
+	// Replacing the token or environment must not panic either.
+	h.SetToken("some-token")
+	h.SetEnvironment("staging")
+}
+
+func TestWithTags(t *testing.T) {
+	var got map[string]interface{}
+	h := NewHook("", "testing", WithTags("payments", "critical-path"),
+		WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+			got = m
+			return true
+		}))
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	entry.Data[tagsField] = "checkout, payments"
+
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	expected := []string{"payments", "critical-path", "checkout"}
+	if !reflect.DeepEqual(got["tags"], expected) {
+		t.Fatalf("got tags %v, wanted %v", got["tags"], expected)
+	}
+	if _, exists := got[tagsField]; exists {
+		t.Fatalf("expected %s to be removed from the extras", tagsField)
+	}
+}
+
+func TestWithLevelsAndWithMinLevelLastWins(t *testing.T) {
+	h := NewHook("", "testing", WithMinLevel(logrus.InfoLevel), WithLevels(logrus.PanicLevel))
+	if !reflect.DeepEqual(h.Levels(), []logrus.Level{logrus.PanicLevel}) {
+		t.Fatal("Expected WithLevels to override WithMinLevel")
+	}
+
+	h = NewHook("", "testing", WithLevels(logrus.PanicLevel), WithMinLevel(logrus.FatalLevel))
+	expectedLevels := []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+	}
+	if !reflect.DeepEqual(h.Levels(), expectedLevels) {
+		t.Fatal("Expected WithMinLevel to override WithLevels")
+	}
+}
+
+func TestInheritedFieldsAreReported(t *testing.T) {
+	var got map[string]interface{}
+	h := NewHook("", "testing", WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+		got = m
+		return true
+	}))
+	l := logrus.New()
+	l.AddHook(h)
+
+	base := l.WithField("service", "api")
+	base.WithError(io.EOF).WithField("request_id", "abc").Error("This is a test")
+
+	if got["service"] != "api" {
+		t.Fatalf("expected the service field to be reported, got %v", got)
+	}
+	if got["request_id"] != "abc" {
+		t.Fatalf("expected the request_id field to be reported, got %v", got)
+	}
+}
+
+func TestWithDynamicMinLevel(t *testing.T) {
+	threshold := logrus.ErrorLevel
+	h := NewHook("", "testing", WithMinLevel(logrus.WarnLevel), WithDynamicMinLevel(func() logrus.Level {
+		return threshold
+	}))
+	if !reflect.DeepEqual(h.Levels(), logrus.AllLevels) {
+		t.Fatal("Expected Levels() to return all levels")
+	}
+
+	l := logrus.New()
+	l.AddHook(h)
+
+	l.Warn("This is a test")
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+
+	l.Info("This is a test")
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+
+	threshold = logrus.WarnLevel
+	l.Warn("This is a test")
+	if !h.reported {
+		t.Fatal("expected report to have happened")
+	}
+}
+
+func TestWithoutSyntheticFields(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     []OptionFunc
+		expected bool
+	}{
+		{name: "default", expected: true},
+		{name: "without synthetic fields", opts: []OptionFunc{WithoutSyntheticFields()}, expected: false},
+	}
+
+	for _, c := range cases {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			var got map[string]interface{}
+			opts := append(c.opts, WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+				got = m
+				return true
+			}))
+			h := NewHook("", "testing", opts...)
+
+			entry := logrus.NewEntry(nil)
+			entry.Message = "This is a test"
+			if err := h.Fire(entry); err != nil {
+				t.Fatal("unexpected error ", err)
+			}
+
+			for _, k := range []string{"time", "msg"} {
+				if _, exists := got[k]; exists != c.expected {
+					t.Errorf("expected %s to exist: %t, got %v", k, c.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLevelSeverity(t *testing.T) {
+	cases := []struct {
+		name     string
+		level    logrus.Level
+		field    interface{}
+		expected string
+	}{
+		{name: "error", level: logrus.ErrorLevel, expected: rollbar.ERR},
+		{name: "fatal", level: logrus.FatalLevel, expected: rollbar.CRIT},
+		{name: "trace", level: logrus.TraceLevel, expected: rollbar.DEBUG},
+		{name: "critical override", level: logrus.ErrorLevel, field: "critical", expected: rollbar.CRIT},
+		{name: "unknown override", level: logrus.ErrorLevel, field: "urgent", expected: rollbar.ERR},
+	}
+
+	for _, c := range cases {
+		entry := logrus.NewEntry(nil)
+		entry.Level = c.level
+		if c.field != nil {
+			entry.Data[levelField] = c.field
+		}
+
+		if got := levelSeverity(entry); got != c.expected {
+			t.Errorf("%s: got severity %q, wanted %q", c.name, got, c.expected)
+		}
+	}
+}
+
+func TestFramesToSkipWithSyntheticFrames(t *testing.T) {
+	defer func(orig func(int) (uintptr, string, int, bool)) { callerFunc = orig }(callerFunc)
+
+	cases := []struct {
+		name     string
+		files    []string
+		expected int
+	}{
+		{
+			name: "direct logrus call",
+			files: []string{
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/sirupsen/logrus/hooks.go",
+				"github.com/sirupsen/logrus/entry.go",
+				"github.com/sirupsen/logrus/entry.go",
+				"main.go",
+			},
+			expected: 7,
+		},
+		{
+			name: "wrapper logger",
+			files: []string{
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/sirupsen/logrus/hooks.go",
+				"github.com/sirupsen/logrus/entry.go",
+				"github.com/sirupsen/logrus/entry.go",
+				"github.com/sirupsen/logrus/logger.go",
+				"app/log/wrapper.go",
+				"main.go",
+			},
+			expected: 8,
+		},
+		{
+			name: "stack ends inside logrus",
+			files: []string{
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/sirupsen/logrus/hooks.go",
+			},
+			expected: 5,
+		},
+		{
+			name: "too many logrus frames",
+			files: append([]string{
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+				"github.com/heroku/rollrus/hook.go",
+			}, logrusFrames(100)...),
+			expected: 4,
+		},
+	}
+
+	for _, c := range cases {
+		files := c.files
+		callerFunc = func(skip int) (uintptr, string, int, bool) {
+			if skip >= len(files) {
+				return 0, "", 0, false
+			}
+			return 0, files[skip], 1, true
+		}
+
+		if got := framesToSkip(2); got != c.expected {
+			t.Errorf("%s: expected frames to skip to be %d, got %d", c.name, c.expected, got)
+		}
+	}
+}
+
+// logrusFrames returns the files of n frames within logrus.
+func logrusFrames(n int) []string {
+	files := make([]string, n)
+	for i := range files {
+		files[i] = "github.com/sirupsen/logrus/entry.go"
+	}
+	return files
+}
+
+func BenchmarkFramesToSkipDeepLogrusStack(b *testing.B) {
+	defer func(orig func(int) (uintptr, string, int, bool)) { callerFunc = orig }(callerFunc)
+	callerFunc = func(skip int) (uintptr, string, int, bool) {
+		return 0, "github.com/sirupsen/logrus/entry.go", 1, true
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		framesToSkip(2)
+	}
+}
+
+func TestFireWithoutClientCallsOnError(t *testing.T) {
+	var got error
+	h := &Hook{onError: func(err error) { got = err }}
+
+	if err := h.Fire(logrus.NewEntry(nil)); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if got != errNoClient {
+		t.Fatalf("expected %v, got %v", errNoClient, got)
+	}
+}
+
+func TestWithSkipOnCanceledContext(t *testing.T) {
+	h := NewHook("", "testing", WithSkipOnCanceledContext())
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entry.Context = ctx
+	cancel()
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+
+	entry.Context = context.Background()
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if !h.reported {
+		t.Fatal("expected a report to have happened")
+	}
+}
+
+func TestWithObserveLevels(t *testing.T) {
+	h := NewHook("", "testing", WithObserveLevels(logrus.InfoLevel))
+	expectedLevels := []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.InfoLevel,
+	}
+	if !reflect.DeepEqual(h.Levels(), expectedLevels) {
+		t.Fatalf("Expected Levels() to return the observed and reported levels, got %v", h.Levels())
+	}
+
+	l := logrus.New()
+	l.AddHook(h)
+
+	l.Info("This is a test")
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+
+	l.Error("This is a test")
+	if !h.reported {
+		t.Fatal("expected report to have happened")
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func (c fixedClock) Sleep(time.Duration) {}
+
+func (c fixedClock) NewTicker(time.Duration) Ticker {
+	return fakeTicker(nil)
+}
+
+// fakeClock is a fixedClock that records how long it was asked to sleep and
+// whose tickers tick whenever a time is sent on ticks.
+type fakeClock struct {
+	fixedClock
+	ticks chan time.Time
+
+	mu     sync.Mutex
+	sleeps []time.Duration
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{fixedClock: fixedClock(now), ticks: make(chan time.Time)}
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+}
+
+func (c *fakeClock) NewTicker(time.Duration) Ticker {
+	return fakeTicker(c.ticks)
+}
+
+type fakeTicker chan time.Time
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t
+}
+
+func (t fakeTicker) Stop() {}
+
+func TestWithClock(t *testing.T) {
+	now := time.Date(2019, 9, 23, 12, 0, 0, 0, time.UTC)
+	var got map[string]interface{}
+	h := NewHook("", "testing", WithClock(fixedClock(now)), WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+		got = m
+		return true
+	}))
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if got["time"] != now.Format(time.RFC3339) {
+		t.Fatalf("expected the time of the clock, got %v", got["time"])
+	}
+}
+
+func TestWithLevelFilter(t *testing.T) {
+	h := NewHook("", "testing", WithLevelFilter(func(level logrus.Level) bool {
+		return level != logrus.FatalLevel
+	}))
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+
+	entry.Level = logrus.FatalLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+
+	entry.Level = logrus.ErrorLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if !h.reported {
+		t.Fatal("expected a report to have happened")
+	}
+}
+
+func TestWithLevelsByEnv(t *testing.T) {
+	levels := map[string][]logrus.Level{
+		"Staging": {
+			logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel,
+			logrus.WarnLevel, logrus.InfoLevel, logrus.DebugLevel,
+		},
+		"*": {logrus.PanicLevel},
+	}
+
+	cases := []struct {
+		env      string
+		expected []logrus.Level
+	}{
+		{env: "staging", expected: levels["Staging"]},
+		{env: "production", expected: levels["*"]},
+	}
+
+	for _, c := range cases {
+		h := NewHook("", c.env, WithLevelsByEnv(levels))
+		if !reflect.DeepEqual(h.Levels(), c.expected) {
+			t.Errorf("%s: expected levels %v, got %v", c.env, c.expected, h.Levels())
+		}
+	}
+
+	h := NewHook("", "production", WithLevelsByEnv(map[string][]logrus.Level{"staging": {logrus.DebugLevel}}))
+	if !reflect.DeepEqual(h.Levels(), defaultTriggerLevels) {
+		t.Errorf("expected the default levels without a match, got %v", h.Levels())
+	}
+}
+
+func TestWithExtrasFromEnv(t *testing.T) {
+	os.Setenv("ROLLRUS_TEST_DYNO", "web.1")
+	defer os.Unsetenv("ROLLRUS_TEST_DYNO")
+
+	var got map[string]interface{}
+	h := NewHook("", "testing", WithExtrasFromEnv("ROLLRUS_TEST_DYNO", "ROLLRUS_TEST_UNSET"),
+		WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+			got = m
+			return true
+		}))
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if got["ROLLRUS_TEST_DYNO"] != "web.1" {
+		t.Errorf("expected ROLLRUS_TEST_DYNO to be reported, got %v", got)
+	}
+	if _, exists := got["ROLLRUS_TEST_UNSET"]; exists {
+		t.Errorf("expected unset variables to be skipped, got %v", got)
+	}
+}
+
+func TestWithCustom(t *testing.T) {
+	custom := map[string]interface{}{"region": "eu", "service": "billing"}
+	var got map[string]interface{}
+	h := NewHook("", "testing", WithCustom(custom), WithIgnoreFunc(func(err error, m map[string]interface{}) bool {
+		got = m
+		return true
+	}))
+	custom["region"] = "us"
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	entry.Data["service"] = "payments"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if got["region"] != "eu" {
+		t.Errorf("expected the custom data to be copied, got %v", got["region"])
+	}
+	if got["service"] != "payments" {
+		t.Errorf("expected fields to take precedence, got %v", got["service"])
+	}
+}
+
+func TestWithSkipIf(t *testing.T) {
+	converted := false
+	h := NewHook("", "testing",
+		WithSkipIf(func(entry *logrus.Entry) bool {
+			return entry.Data["noisy"] == true
+		}),
+		WithFieldFormatter(func(string, interface{}) (interface{}, bool) {
+			converted = true
+			return nil, false
+		}),
+	)
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	entry.Data["noisy"] = true
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if h.reported || converted {
+		t.Fatal("expected the entry to be skipped before converting fields")
+	}
+
+	entry.Data["noisy"] = false
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if !h.reported {
+		t.Fatal("expected a report to have happened")
+	}
+}
+
+func TestWithIgnoreContextErrors(t *testing.T) {
+	h := NewHook("", "testing", WithIgnoreContextErrors(), WithIgnoredErrors(io.EOF))
+
+	for _, err := range []error{
+		context.Canceled,
+		context.DeadlineExceeded,
+		fmt.Errorf("query: %w", context.Canceled),
+		errors.Wrap(context.DeadlineExceeded, "query"),
+		io.EOF,
+	} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Data["err"] = err
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+		if h.reported {
+			t.Fatalf("expected %v to be ignored", err)
+		}
+	}
+	if s := h.Stats(); s.Ignored != 5 {
+		t.Errorf("Ignored = %d, want 5", s.Ignored)
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Data["err"] = io.ErrUnexpectedEOF
+	_ = h.Fire(entry)
+	if !h.reported {
+		t.Fatal("expected other errors to be reported")
+	}
+}
+
+func TestWillReport(t *testing.T) {
+	h := NewHook("", "testing", WithIgnoredErrors(io.EOF), WithCountedIgnore(func(err error) (bool, string) {
+		return err == io.ErrClosedPipe, "closed"
+	}))
+
+	for _, tc := range []struct {
+		level logrus.Level
+		err   error
+		want  bool
+	}{
+		{logrus.ErrorLevel, io.ErrUnexpectedEOF, true},
+		{logrus.InfoLevel, io.ErrUnexpectedEOF, false},
+		{logrus.ErrorLevel, io.EOF, false},
+		{logrus.ErrorLevel, io.ErrClosedPipe, false},
+	} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = tc.level
+		entry.Data["err"] = tc.err
+		if got := h.WillReport(entry); got != tc.want {
+			t.Errorf("WillReport(%v, %v) = %v, want %v", tc.level, tc.err, got, tc.want)
+		}
+	}
+
+	if h.reported {
+		t.Error("expected WillReport not to report")
+	}
+	if s := h.Stats(); s != (HookStats{}) {
+		t.Errorf("expected WillReport not to count entries, got %+v", s)
+	}
+	if labels := h.IgnoredByLabel(); len(labels) != 0 {
+		t.Errorf("expected WillReport not to count labels, got %v", labels)
+	}
+}
+
+func TestWithItemCustomizer(t *testing.T) {
+	var gotLevel logrus.Level
+	var gotErr error
+	customize := func(level logrus.Level, err error, extras map[string]interface{}) map[string]interface{} {
+		gotLevel, gotErr = level, err
+		if extras["url"] != "https://example.com/?key=[FILTERED]" {
+			t.Errorf("expected the customizer to run after redaction, got %v", extras["url"])
+		}
+		return map[string]interface{}{"url": "https://example.com/?key=public", "tenant": "acme"}
+	}
+	h := NewHook("", "testing", WithRedactURLQueryParams(), WithItemCustomizer(customize))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.WarnLevel
+	entry.Data["err"] = errors.Wrap(io.EOF, "fetch")
+	entry.Data["url"] = "https://example.com/?key=secret"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if gotLevel != logrus.WarnLevel || gotErr != io.EOF {
+		t.Errorf("expected the level and cause to be passed, got %v and %v", gotLevel, gotErr)
+	}
+	custom := ft.sent[0]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if custom["url"] != "https://example.com/?key=public" || custom["tenant"] != "acme" {
+		t.Errorf("expected the returned fields to be merged, got %v", custom)
+	}
+}
+
+func TestWithProjectRouter(t *testing.T) {
+	tenant := rollbar.NewSync("tenant-token", "testing", "", "", "")
+	h := NewHook("", "testing", WithProjectRouter(map[string]*rollbar.Client{"acme": tenant}, "rollbar_project"))
+	ft := withFakeTransport(h, &fakeTransport{})
+	tenantFT := &fakeTransport{SyncTransport: rollbar.NewSyncTransport("", "")}
+	tenant.Transport.(*transport).Transport = tenantFT
+
+	for _, project := range []interface{}{"acme", "unknown", nil} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		if project != nil {
+			entry.Data["rollbar_project"] = project
+		}
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if len(tenantFT.sent) != 1 {
+		t.Fatalf("expected one report for the tenant, got %d", len(tenantFT.sent))
+	}
+	if len(ft.sent) != 2 {
+		t.Fatalf("expected two reports through the default client, got %d", len(ft.sent))
+	}
+	data := tenantFT.sent[0]["data"].(map[string]interface{})
+	if _, ok := data["custom"].(map[string]interface{})["rollbar_project"]; ok {
+		t.Error("expected the project field not to be reported")
+	}
+	if _, ok := data["custom"].(map[string]interface{})[occurrenceKey]; ok {
+		t.Error("expected the occurrence to be applied by the wrapped transport")
+	}
+}
+
+func TestWithClient(t *testing.T) {
+	c := rollbar.NewSync("other-token", "staging", "", "", "")
+	h := NewHook("", "testing", WithClient(c))
+	if h.Client != c {
+		t.Fatal("expected the hook to use the given client")
+	}
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected one report, got %d", len(ft.sent))
+	}
+	if ft.sent[0]["access_token"] != "other-token" {
+		t.Errorf("expected the client's token to be used, got %v", ft.sent[0]["access_token"])
+	}
+	if s := h.Stats(); s.Reported != 1 {
+		t.Errorf("expected the hook to count the report, got %+v", s)
+	}
+}
+
+func TestWait(t *testing.T) {
+	h := NewHook("", "testing", WithBatching(time.Hour))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	for i := 0; i < 2; i++ {
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+		h.Wait()
+		if len(ft.sent) != i+1 {
+			t.Fatalf("expected Wait to send the batched report, got %d sent", len(ft.sent))
+		}
+	}
+}
+
+func TestCloseNilHook(t *testing.T) {
+	var h *Hook
+	h.Wait()
+	if err := h.Close(); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+}
+
+func TestWithShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	h := NewHook("some-token", "testing", WithAsync(1), WithShutdownTimeout(10*time.Millisecond))
+	h.Client.SetEndpoint(ts.URL)
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Wait to give up after the timeout")
+	}
+
+	if err := h.Close(); err != ErrShutdownTimeout {
+		t.Errorf("expected ErrShutdownTimeout, got %v", err)
+	}
+}
+
+func TestWithServerData(t *testing.T) {
+	h := NewHook("", "testing", WithPlatform("kubernetes"), WithCodeVersion("abc123"),
+		WithServerHost("web-1"), WithServerRoot("github.com/heroku/rollrus"))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	if data["platform"] != "kubernetes" {
+		t.Errorf("got platform %v, wanted %q", data["platform"], "kubernetes")
+	}
+	if data["code_version"] != "abc123" {
+		t.Errorf("got code_version %v, wanted %q", data["code_version"], "abc123")
+	}
+	server := data["server"].(map[string]interface{})
+	if server["host"] != "web-1" || server["root"] != "github.com/heroku/rollrus" {
+		t.Errorf("unexpected server data %v", server)
+	}
+}
+
+func TestSetTokenAndEnvironment(t *testing.T) {
+	h := NewHook("old-token", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			entry := logrus.NewEntry(nil)
+			entry.Level = logrus.ErrorLevel
+			entry.Message = "This is a test"
+			_ = h.Fire(entry)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			h.SetToken("new-token")
+			h.SetEnvironment("staging")
+		}
+	}()
+	wg.Wait()
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	last := ft.sent[len(ft.sent)-1]
+	if last["access_token"] != "new-token" || last["data"].(map[string]interface{})["environment"] != "staging" {
+		t.Errorf("expected the new credentials to be used, got %v", last)
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	h := NewHook("", "testing", WithAdjustableLevels())
+	ft := withFakeTransport(h, &fakeTransport{})
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+
+	l.Warn("before")
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected warnings not to be reported by default, got %d sent", len(ft.sent))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.SetMinLevel(logrus.WarnLevel)
+	}()
+	l.Error("concurrently")
+	<-done
+
+	l.Warn("during")
+	if got := len(ft.sent); got != 2 {
+		t.Fatalf("expected the warning to be reported after SetMinLevel, got %d sent", got)
+	}
+
+	h.SetLevels(logrus.PanicLevel)
+	l.Error("after")
+	if got := len(ft.sent); got != 2 {
+		t.Fatalf("expected errors not to be reported after SetLevels, got %d sent", got)
+	}
+	if levels := h.Levels(); len(levels) != len(logrus.AllLevels) {
+		t.Errorf("expected an adjustable hook to ask for all levels, got %v", levels)
+	}
+}
+
+func TestSetLevelsNarrowsAddedHook(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+
+	h.SetLevels(logrus.FatalLevel)
+	l.Error("This is a test")
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected errors to be filtered after SetLevels, got %d sent", len(ft.sent))
+	}
+}
+
+func TestDisable(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+
+	h.Disable()
+	for i := 0; i < 2; i++ {
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+	if h.WillReport(entry) {
+		t.Error("expected a disabled hook not to report")
+	}
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected nothing to be sent while disabled, got %d sent", len(ft.sent))
+	}
+
+	h.Enable()
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected one item to be sent after Enable, got %d sent", len(ft.sent))
+	}
+	if s := h.Stats(); s.Suppressed != 2 || s.Reported != 1 {
+		t.Errorf("expected two suppressed entries and one report, got %+v", s)
+	}
+}
+
+func TestWithEnabledEnvironments(t *testing.T) {
+	h := NewHook("", "development", WithEnabledEnvironments("production", "staging"))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected nothing to be sent from development, got %d sent", len(ft.sent))
+	}
+
+	h.SetEnvironment("staging")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected one item to be sent from staging, got %d sent", len(ft.sent))
+	}
+	if s := h.Stats(); s.Suppressed != 1 || s.Reported != 1 {
+		t.Errorf("expected one suppressed entry and one report, got %+v", s)
+	}
+}
+
+func TestWithIgnoreErrorReportFunc(t *testing.T) {
+	var got ReportContext
+	h := NewHook("", "testing",
+		WithIgnoreErrorReportFunc(func(rc ReportContext) bool {
+			got = rc
+			return rc.Entry.Data["component"] == "health"
+		}),
+		WithCountedIgnoreReport(func(rc ReportContext) (bool, string) {
+			return rc.Level == logrus.WarnLevel, "warnings"
+		}),
+		WithLevels(logrus.ErrorLevel, logrus.WarnLevel),
+	)
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["err"] = io.EOF
+	entry.Data["component"] = "health"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if got.Err != io.EOF || got.Level != logrus.ErrorLevel || got.Message != "This is a test" || got.Extras != nil {
+		t.Errorf("unexpected ReportContext %+v", got)
+	}
+
+	entry.Data["component"] = "api"
+	entry.Level = logrus.WarnLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	entry.Level = logrus.ErrorLevel
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(ft.sent) != 1 {
+		t.Errorf("expected only the api error to be reported, got %d sent", len(ft.sent))
+	}
+	if got := h.IgnoredByLabel(); got["warnings"] != 1 {
+		t.Errorf("expected the warning to be counted, got %v", got)
+	}
+}
+
+func TestIgnoredErrorsSkipFieldConversion(t *testing.T) {
+	converted := false
+	h := NewHook("", "testing",
+		WithIgnoredErrors(io.EOF),
+		WithIgnoreErrorFunc(func(err error) bool { return err == io.ErrUnexpectedEOF }),
+		WithFieldFormatter(func(string, interface{}) (interface{}, bool) {
+			converted = true
+			return nil, false
+		}),
+	)
+
+	for _, err := range []error{io.EOF, io.ErrUnexpectedEOF} {
+		entry := logrus.NewEntry(nil)
+		entry.Data["err"] = err
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if converted {
+		t.Fatal("expected ignored errors to be dropped before converting fields")
+	}
+}
+
+func BenchmarkFireIgnoredError(b *testing.B) {
+	h := NewHook("", "testing", WithIgnoredErrors(context.Canceled))
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["err"] = context.Canceled
+	entry.Data["request_id"] = "abc"
+	entry.Data["user_id"] = 42
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := h.Fire(entry); err != nil {
+			b.Fatal("unexpected error ", err)
+		}
+	}
+}
+
+func BenchmarkFireIgnoreErrorFunc(b *testing.B) {
+	h := NewHook("", "testing", WithIgnoreErrorFunc(func(err error) bool {
+		return err == context.Canceled
+	}))
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["err"] = context.Canceled
+	entry.Data["request_id"] = "abc"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := h.Fire(entry); err != nil {
+			b.Fatal("unexpected error ", err)
+		}
+	}
+}
+
+// TestFireIgnoredErrorDoesNotAllocate guards the fast path for ignored
+// errors, which are dropped before the fields are converted.
+func TestFireIgnoredErrorDoesNotAllocate(t *testing.T) {
+	hooks := map[string]*Hook{
+		"WithIgnoredErrors": NewHook("", "testing", WithIgnoredErrors(context.Canceled)),
+		"WithIgnoreErrorFunc": NewHook("", "testing", WithIgnoreErrorFunc(func(err error) bool {
+			return err == context.Canceled
+		})),
+	}
+
+	for name, h := range hooks {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		entry.Data["err"] = context.Canceled
+		entry.Data["request_id"] = "abc"
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = h.Fire(entry)
+		})
+		if allocs != 0 {
+			t.Errorf("%s: expected no allocations, got %v", name, allocs)
+		}
+	}
+}
+
+func TestWithIgnoreReportFunc(t *testing.T) {
+	var got ReportContext
+	h := NewHook("", "testing", WithIgnoreReportFunc(func(rc ReportContext) bool {
+		got = rc
+		return rc.Level == logrus.ErrorLevel
+	}))
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["err"] = errors.Wrap(io.EOF, "hello")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if h.reported {
+		t.Fatal("expected no report to have happened")
+	}
+	if got.Err != io.EOF || got.Message != entry.Message || got.Entry != entry || got.Extras["msg"] != entry.Message {
+		t.Fatalf("unexpected report context %+v", got)
+	}
+}
+
+func TestWithDiagnosticWriter(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("", "testing", WithDiagnosticWriter(&buf), WithMinLevel(logrus.InfoLevel), WithLevels(logrus.ErrorLevel))
+
+	if got := buf.String(); got != "rollrus: WithLevels overrides the levels set by WithMinLevel\n" {
+		t.Fatalf("expected the diagnostic to be written, got %q", got)
+	}
+
+	buf.Reset()
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if !strings.Contains(buf.String(), "Rollbar error: empty token") {
+		t.Fatalf("expected the rollbar client to write to the diagnostic writer, got %q", buf.String())
+	}
+}
+
+type retryableError struct{}
+
+func (*retryableError) Error() string { return "retryable" }
+func (*retryableError) Timeout() bool { return true }
+
+func TestWithLevelForErrorType(t *testing.T) {
+	var target *retryableError
+	var timeout interface{ Timeout() bool }
+	h := NewHook("", "testing",
+		WithLevelForErrorType(&target, rollbar.WARN),
+		WithLevelForErrorType(&timeout, rollbar.INFO),
+	)
+
+	cases := []struct {
+		name     string
+		level    logrus.Level
+		err      error
+		expected string
+	}{
+		{name: "first rule wins", level: logrus.ErrorLevel, err: &retryableError{}, expected: rollbar.WARN},
+		{
+			name:     "wrapped match",
+			level:    logrus.ErrorLevel,
+			err:      fmt.Errorf("doing: %w", &retryableError{}),
+			expected: rollbar.WARN,
+		},
+		{name: "interface match", level: logrus.ErrorLevel, err: timeoutError{}, expected: rollbar.INFO},
+		{name: "no match", level: logrus.ErrorLevel, err: errors.New("other"), expected: rollbar.ERR},
+		{name: "critical is kept", level: logrus.FatalLevel, err: &retryableError{}, expected: rollbar.CRIT},
+	}
+
+	for _, c := range cases {
+		entry := logrus.NewEntry(nil)
+		entry.Level = c.level
+		if got := h.severity(entry, c.err); got != c.expected {
+			t.Errorf("%s: got severity %q, wanted %q", c.name, got, c.expected)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestWithLevelForErrorTypeRejectsInvalidTargets(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("", "testing", WithDiagnosticWriter(&buf),
+		WithLevelForErrorType(nil, rollbar.WARN),
+		WithLevelForErrorType(&retryableError{}, rollbar.WARN),
+		WithLevelForErrorType(new(string), rollbar.WARN),
+		WithLevelForErrorType(new(error), "warn"),
+	)
+
+	if len(h.errorTypeLevels) != 0 {
+		t.Errorf("expected no rules, got %d", len(h.errorTypeLevels))
+	}
+	if n := strings.Count(buf.String(), "WithLevelForErrorType"); n != 4 {
+		t.Errorf("expected 4 warnings, got %d: %q", n, buf.String())
+	}
+}
+
+func TestWithDropIfNoError(t *testing.T) {
+	h := NewHook("", "testing", WithDropIfNoError())
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if h.reported {
+		t.Fatal("expected entries without an error to be dropped")
+	}
+	if s := h.Stats(); s.Ignored != 1 {
+		t.Errorf("expected 1 ignored entry, got %d", s.Ignored)
+	}
+
+	entry.Data["err"] = errors.New("boom")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if !h.reported {
+		t.Fatal("expected entries with an error to be reported")
+	}
+}
+
+type cyclicError struct{ next error }
+
+func (e *cyclicError) Error() string { return "cyclic" }
+func (e *cyclicError) Unwrap() error { return e.next }
+
+func TestRootCause(t *testing.T) {
+	inner := io.EOF
+	if got := rootCause(fmt.Errorf("a: %w", fmt.Errorf("b: %w", inner))); got != inner {
+		t.Errorf("got %v, wanted %v", got, inner)
+	}
+	if got := rootCause(fmt.Errorf("a: %w", errors.Wrap(inner, "b"))); got != inner {
+		t.Errorf("got %v, wanted %v through Cause", got, inner)
+	}
+
+	a, b := &cyclicError{}, &cyclicError{}
+	a.next, b.next = b, a
+	if got := rootCause(a); got != a && got != b {
+		t.Errorf("expected a cyclic chain to end in the cycle, got %v", got)
+	}
+}
+
+func TestWithErrorCauseField(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		field string
+	}{
+		{name: "default key", key: "", field: "root_cause"},
+		{name: "custom key", key: "leaf", field: "leaf"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got map[string]interface{}
+			h := NewHook("", "testing", WithErrorCauseField(c.key), WithIgnoreReportFunc(func(rc ReportContext) bool {
+				got = rc.Extras
+				return true
+			}))
+
+			entry := logrus.NewEntry(nil)
+			entry.Level = logrus.ErrorLevel
+			entry.Data["err"] = fmt.Errorf("loading config: %w", io.ErrUnexpectedEOF)
+			if err := h.Fire(entry); err != nil {
+				t.Fatal("unexpected error ", err)
+			}
+
+			if got[c.field] != io.ErrUnexpectedEOF.Error() {
+				t.Errorf("got %s %v, wanted %q", c.field, got[c.field], io.ErrUnexpectedEOF.Error())
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{s: "short", n: 10, expected: "short"},
+		{s: "exactly", n: 7, expected: "exactly"},
+		{s: "too long", n: 3, expected: "too…"},
+		{s: "größer", n: 3, expected: "grö…"},
+		{s: "unlimited", n: -1, expected: "unlimited"},
+	}
+
+	for _, c := range cases {
+		if got := truncate(c.s, c.n); got != c.expected {
+			t.Errorf("truncate(%q, %d) = %q, wanted %q", c.s, c.n, got, c.expected)
+		}
+	}
+}
+
+func TestMessageExtraIsTruncated(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     []OptionFunc
+		expected int
+	}{
+		{name: "default", expected: defaultMaxMessageLength + len("…")},
+		{name: "configured", opts: []OptionFunc{WithMaxMessageLength(10)}, expected: 10 + len("…")},
+		{name: "disabled", opts: []OptionFunc{WithMaxMessageLength(-1)}, expected: 2000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got map[string]interface{}
+			opts := append(c.opts, WithIgnoreReportFunc(func(rc ReportContext) bool {
+				got = rc.Extras
+				return true
+			}))
+			h := NewHook("", "testing", opts...)
+
+			entry := logrus.NewEntry(nil)
+			entry.Level = logrus.ErrorLevel
+			entry.Message = strings.Repeat("x", 2000)
+			if err := h.Fire(entry); err != nil {
+				t.Fatal("unexpected error ", err)
+			}
+
+			if n := len(got["msg"].(string)); n != c.expected {
+				t.Errorf("got a msg of %d bytes, wanted %d", n, c.expected)
+			}
+		})
+	}
+}
+
+func TestWithReportChannel(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ch := make(chan Report, 1)
+	h := NewHook("", "testing", WithReportChannel(ch), WithClock(fixedClock(now)))
+	withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Data["err"] = io.EOF
+	entry.Data["user"] = "alice"
+	for i := 0; i < 2; i++ {
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if len(ch) != 1 {
+		t.Fatalf("expected the second report to be dropped, got %d reports", len(ch))
+	}
+	r := <-ch
+	if r.Level != logrus.ErrorLevel || r.Err != io.EOF || !r.Time.Equal(now) {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if r.Extras["user"] != "alice" {
+		t.Errorf("expected the extras to be included, got %v", r.Extras)
+	}
+	if _, exists := r.Extras[occurrenceKey]; exists {
+		t.Errorf("expected no internal extras, got %v", r.Extras)
+	}
+}
+
+func TestSeverityField(t *testing.T) {
+	var target *retryableError
+	h := NewHook("", "testing", WithLevelForErrorType(&target, rollbar.DEBUG))
+
+	cases := []struct {
+		name     string
+		level    logrus.Level
+		err      error
+		field    interface{}
+		expected string
+	}{
+		{name: "raised", level: logrus.InfoLevel, field: "warning", expected: rollbar.WARN},
+		{name: "lowered", level: logrus.FatalLevel, field: "error", expected: rollbar.ERR},
+		{name: "case insensitive", level: logrus.InfoLevel, field: "CRITICAL", expected: rollbar.CRIT},
+		{
+			name:     "overrides type rules",
+			level:    logrus.ErrorLevel,
+			err:      &retryableError{},
+			field:    "warning",
+			expected: rollbar.WARN,
+		},
+		{name: "invalid value", level: logrus.InfoLevel, field: "urgent", expected: rollbar.INFO},
+		{name: "not a string", level: logrus.InfoLevel, field: 3, expected: rollbar.INFO},
+	}
+
+	for _, c := range cases {
+		entry := logrus.NewEntry(nil)
+		entry.Level = c.level
+		entry.Data[severityField] = c.field
+		if got := h.severity(entry, c.err); got != c.expected {
+			t.Errorf("%s: got severity %q, wanted %q", c.name, got, c.expected)
+		}
+	}
+}
+
+func TestSeverityFieldIsNotReported(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "This is a test"
+	entry.Data[severityField] = "warning"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	if data["level"] != rollbar.WARN {
+		t.Errorf("got level %v, wanted %q", data["level"], rollbar.WARN)
+	}
+	if _, exists := data["custom"].(map[string]interface{})[severityField]; exists {
+		t.Errorf("expected %s to be removed from the custom data", severityField)
+	}
+}
+
+func TestRequestField(t *testing.T) {
+	for _, level := range []logrus.Level{logrus.ErrorLevel, logrus.InfoLevel} {
+		t.Run(level.String(), func(t *testing.T) {
+			h := NewHook("", "testing")
+			ft := withFakeTransport(h, &fakeTransport{})
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/orders?id=1", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Cookie", "session=secret")
+			req.Header.Set("Accept", "text/plain")
+
+			entry := logrus.NewEntry(nil)
+			entry.Level = level
+			entry.Message = "This is a test"
+			entry.Data[requestField] = req
+			if err := h.Fire(entry); err != nil {
+				t.Fatal("unexpected error ", err)
+			}
+
+			data := ft.sent[0]["data"].(map[string]interface{})
+			request, ok := data["request"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected request data, got %v", data["request"])
+			}
+			if request["url"] != "http://example.com/orders?id=1" || request["method"] != http.MethodGet {
+				t.Errorf("unexpected request data %v", request)
+			}
+			headers := request["headers"].(map[string]interface{})
+			if headers["Authorization"] != rollbar.FILTERED || headers["Cookie"] != rollbar.FILTERED {
+				t.Errorf("expected credentials to be scrubbed, got %v", headers)
+			}
+			if headers["Accept"] != "text/plain" {
+				t.Errorf("expected other headers to be reported, got %v", headers)
+			}
+			if custom, ok := data["custom"].(map[string]interface{}); ok {
+				if _, exists := custom[requestField]; exists {
+					t.Errorf("expected %s to be removed from the custom data", requestField)
+				}
+			}
+		})
+	}
+}
+
+func TestWithFieldKeyRename(t *testing.T) {
+	var buf bytes.Buffer
+	var got map[string]interface{}
+	h := NewHook("", "testing",
+		WithDiagnosticWriter(&buf),
+		WithFieldKeyRename(map[string]string{"userID": "user_id", "uid": "user_id", "reqID": "request_id"}),
+		WithIgnoreReportFunc(func(rc ReportContext) bool {
+			got = rc.Extras
+			return true
+		}),
+	)
+	if !strings.Contains(buf.String(), "uid, userID to user_id, userID wins") {
+		t.Errorf("expected a warning about the conflicting keys, got %q", buf.String())
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Data["userID"] = "alice"
+	entry.Data["uid"] = "bob"
+	entry.Data["reqID"] = "1234"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if got["user_id"] != "alice" || got["request_id"] != "1234" {
+		t.Errorf("expected the fields to be renamed, got %v", got)
+	}
+	for _, k := range []string{"userID", "uid", "reqID"} {
+		if _, exists := got[k]; exists {
+			t.Errorf("expected %s to be renamed, got %v", k, got)
+		}
+	}
+}
+
+func TestWithFieldKeyRenameSwapsKeys(t *testing.T) {
+	var got map[string]interface{}
+	h := NewHook("", "testing",
+		WithFieldKeyRename(map[string]string{"a": "b", "b": "a", "x": "y", "y": "z"}),
+		WithIgnoreReportFunc(func(rc ReportContext) bool {
+			got = rc.Extras
+			return true
+		}),
+	)
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Data["a"] = "1"
+	entry.Data["b"] = "2"
+	entry.Data["x"] = "3"
+	entry.Data["y"] = "4"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if got["a"] != "2" || got["b"] != "1" || got["y"] != "3" || got["z"] != "4" {
+		t.Errorf("expected the fields to be renamed at once, got %v", got)
+	}
+	if _, exists := got["x"]; exists {
+		t.Errorf("expected x to be renamed, got %v", got)
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	errBusy := errors.New("busy")
+	h := NewHook("", "testing", WithDryRun(&buf), WithSentinelGroup("upstream", errBusy), WithoutSyntheticFields())
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Time = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry.Message = "calling upstream"
+	entry.Data["err"] = errBusy
+	entry.Data["user"] = "alice"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(ft.sent) != 0 {
+		t.Fatalf("expected nothing to be sent, got %d items", len(ft.sent))
+	}
+	expected := `{
+  "error": "busy",
+  "extras": {
+    "err": "busy",
+    "user": "alice"
+  },
+  "fingerprint": "upstream",
+  "level": "error",
+  "message": "calling upstream",
+  "timestamp": "2020-01-02T03:04:05Z"
+}
+`
+	if buf.String() != expected {
+		t.Errorf("got %s, wanted %s", buf.String(), expected)
+	}
+}
+
+func TestWithDryRunShowsOccurrence(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("", "testing",
+		WithDryRun(&buf),
+		WithRedactURLQueryParams(),
+		WithMessageTemplate("{{.Message}} for {{.Fields.user}}"),
+	)
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "calling https://example.com/?token=SECRET"
+	entry.Data["user"] = "alice"
+	entry.Data[envField] = "tenant-a"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	var report map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if strings.Contains(buf.String(), "SECRET") {
+		t.Errorf("expected the token to be redacted, got %s", buf.String())
+	}
+	if report["title"] != "calling https://example.com/?token="+rollbar.FILTERED+" for alice" {
+		t.Errorf("expected the rendered title, got %v", report["title"])
+	}
+	if report["environment"] != "tenant-a" {
+		t.Errorf("expected the environment of the entry, got %v", report["environment"])
+	}
+}
+
+func TestWithFieldAllowlist(t *testing.T) {
+	var got map[string]interface{}
+	h := NewHook("", "testing",
+		WithFieldKeyRename(map[string]string{"uid": "user_id"}),
+		WithFieldAllowlist("user_id", "request_id"),
+		WithIgnoreReportFunc(func(rc ReportContext) bool {
+			got = rc.Extras
+			return true
+		}),
+	)
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["uid"] = "42"
+	entry.Data["request_id"] = "abc"
+	entry.Data["email"] = "alice@example.com"
+	entry.Data["err"] = io.EOF
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	for _, k := range []string{"user_id", "request_id", "time", "msg"} {
+		if _, exists := got[k]; !exists {
+			t.Errorf("expected %s to be reported, got %v", k, got)
+		}
+	}
+	for _, k := range []string{"email", "err", "uid"} {
+		if _, exists := got[k]; exists {
+			t.Errorf("expected %s to be dropped, got %v", k, got)
+		}
+	}
+}
+
+func TestSetTokenWithAsync(t *testing.T) {
+	tokens := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			AccessToken string `json:"access_token"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		tokens <- body.AccessToken
+	}))
+	defer ts.Close()
+
+	h := NewHook("old-token", "testing", WithEndpoint(ts.URL), WithAsync(0))
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	// the first item is being sent while the token is replaced
+	h.SetToken("new-token")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if first, second := <-tokens, <-tokens; first != "old-token" || second != "new-token" {
+		t.Errorf("expected the items to be sent with the old and then the new token, got %q and %q", first, second)
+	}
+}
@@ -0,0 +1,92 @@
+package rollrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/rollbar/rollbar-go"
+)
+
+// httpTransport is a synchronous rollbar.Transport posting items with an
+// http.Client of the caller, see WithHTTPClient. It is configured like the
+// embedded rollbar.SyncTransport, which only ever uses the default client.
+type httpTransport struct {
+	*rollbar.SyncTransport
+	client *http.Client
+}
+
+// newHTTPTransport keeps the settings of sync, if any.
+func newHTTPTransport(client *http.Client, token, endpoint string, sync *rollbar.SyncTransport) *httpTransport {
+	st := rollbar.NewSyncTransport(token, endpoint)
+	if sync != nil {
+		st.Logger = sync.Logger
+		st.RetryAttempts = sync.RetryAttempts
+		st.PrintPayloadOnError = sync.PrintPayloadOnError
+	}
+	return &httpTransport{SyncTransport: st, client: client}
+}
+
+// Send the body to Rollbar, retrying requests that failed without a response
+// up to RetryAttempts times. Like rollbar.SyncTransport nothing is sent
+// without a token.
+func (t *httpTransport) Send(body map[string]interface{}) error {
+	if t.Token == "" {
+		t.logf("Rollbar error: empty token\n")
+		return nil
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.logf("Rollbar error: failed to encode payload: %s\n", err)
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err = t.post(payload); err == nil {
+			return nil
+		}
+		if _, ok := err.(rollbar.ErrHTTPError); ok || attempt >= t.RetryAttempts {
+			break
+		}
+	}
+
+	if t.PrintPayloadOnError {
+		format := "Rollbar item failed to send: %v\n"
+		if t.Logger != nil {
+			t.Logger.Printf(format, body)
+		} else {
+			fmt.Fprintf(os.Stderr, format, body)
+		}
+	}
+	return err
+}
+
+func (t *httpTransport) post(payload []byte) error {
+	resp, err := t.client.Post(t.Endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		t.logf("Rollbar error: POST failed: %s\n", err)
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.logf("Rollbar error: received response: %s\n", resp.Status)
+		return rollbar.ErrHTTPError(resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *httpTransport) logf(format string, args ...interface{}) {
+	if t.Logger != nil {
+		t.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,27 @@
+package rollrus
+
+import "github.com/rollbar/rollbar-go"
+
+// NewNoopHook returns a hook that never reports anything, for unit tests and
+// local runs of code that always registers a hook. It can be used like any
+// other hook, including ReportPanic, Wait and Close, but its client discards
+// all items instead of sending them, even after Enable, and so do the clients
+// of its clones. Ping returns ErrNoToken.
+func NewNoopHook() *Hook {
+	h := NewHook("", "")
+	h.Client.Transport = newTransport(h, noopTransport{})
+	h.Disable()
+	return h
+}
+
+// noopTransport is a rollbar.Transport that discards all items.
+type noopTransport struct{}
+
+func (noopTransport) Send(map[string]interface{}) error { return nil }
+func (noopTransport) Wait()                             {}
+func (noopTransport) Close() error                      { return nil }
+func (noopTransport) SetToken(string)                   {}
+func (noopTransport) SetEndpoint(string)                {}
+func (noopTransport) SetLogger(rollbar.ClientLogger)    {}
+func (noopTransport) SetRetryAttempts(int)              {}
+func (noopTransport) SetPrintPayloadOnError(bool)       {}
@@ -0,0 +1,54 @@
+package rollrus
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewNoopHook(t *testing.T) {
+	h := NewNoopHook()
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+
+	l.Error("This is a test")
+	h.Enable()
+	l.Error("This is a test")
+	func() {
+		defer func() { _ = recover() }()
+		defer h.ReportPanic()
+		panic("boom")
+	}()
+
+	if s := h.Stats(); s.Suppressed != 1 || s.Failed != 0 {
+		t.Errorf("expected one suppressed entry and no failures, got %+v", s)
+	}
+	if err := h.Ping(context.Background()); err != ErrNoToken {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNewNoopHookClone(t *testing.T) {
+	h := NewNoopHook().Clone(WithLevelTokens(map[logrus.Level]string{logrus.PanicLevel: "paging"}))
+	paging := h.tokenClient("paging")
+	if _, ok := paging.Transport.(*transport).Transport.(noopTransport); !ok {
+		t.Errorf("expected the client of another token to discard items, got %T", paging.Transport.(*transport).Transport)
+	}
+}
+
+func TestNilHookReportPanic(t *testing.T) {
+	var h *Hook
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Fatalf("expected the panic to go on, got %v", p)
+		}
+	}()
+	defer h.ReportPanic()
+	panic("boom")
+}
@@ -0,0 +1,239 @@
+package rollrus
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+// occurrenceKey is the extras key used by the hook to pass an occurrence to
+// the transport. It is removed before the item is sent.
+const occurrenceKey = "_rollrus_occurrence"
+
+// occurrence holds data about a single item that can't be expressed through
+// the rollbar.Client API and is instead applied to the item by the transport.
+type occurrence struct {
+	// uuid identifies the occurrence so Rollbar can deduplicate retries.
+	uuid string
+	// stack replaces the frames of the first trace.
+	stack rollbar.Stack
+	// timestamp is when the entry was logged.
+	timestamp time.Time
+	// framework reported for the item, if not empty.
+	framework string
+	// branch reported as server.branch, if not empty.
+	branch string
+	// rewrite, if set, is applied to the title and messages of the item.
+	rewrite func(string) string
+	// telemetry events reported with the item, if any.
+	telemetry []map[string]interface{}
+	// person replaces the person of the item, if set.
+	person map[string]interface{}
+	// fingerprint used by Rollbar to group the item, if not empty.
+	fingerprint string
+	// collapseFrames collapses recursive frames in all traces.
+	collapseFrames bool
+	// environment replaces the environment of the client, if not empty.
+	environment string
+	// title replaces the title of the item, if not empty.
+	title string
+	// source adds source context to the frames of all traces, if set.
+	source *sourceContext
+	// entry the item was reported for, passed to the WithErrorHandler
+	// callback. It isn't applied to the item.
+	entry *logrus.Entry
+	// hook that reported the item, which may be a clone of the one owning
+	// the transport.
+	hook *Hook
+	// err is set by the transport to the error of sending the item.
+	err error
+}
+
+// newOccurrence creates the occurrence for an entry about to be reported.
+func (r *Hook) newOccurrence(entry *logrus.Entry) *occurrence {
+	o := &occurrence{
+		timestamp: r.entryTime(entry),
+		framework: r.framework,
+		branch:    r.serverBranch,
+		telemetry: r.telemetry.snapshot(),
+
+		collapseFrames: r.collapseFrames,
+		source:         r.source,
+		entry:          entry,
+		hook:           r,
+	}
+	if params := r.redactParams; params != nil {
+		o.rewrite = func(s string) string {
+			return redactURLQueryParams(s, params)
+		}
+	}
+	if r.personFunc != nil {
+		o.person = personData(r.personFunc(entry))
+	}
+	if env, ok := entry.Data[envField].(string); ok {
+		o.environment = strings.TrimSpace(env)
+	}
+	if v, ok := entry.Data[r.envSuffixField]; ok && r.envSuffixField != "" {
+		if suffix := strings.TrimSpace(fmt.Sprint(v)); suffix != "" {
+			env := o.environment
+			if env == "" {
+				env = r.client(entry).Environment()
+			}
+			o.environment = env + r.envSuffixSep + suffix
+		}
+	}
+	if id, ok := entry.Data[uuidField].(string); ok && id != "" {
+		o.uuid = id
+	} else {
+		o.uuid = newUUID()
+	}
+	return o
+}
+
+// apply the occurrence to the data of an item.
+func (o *occurrence) apply(data map[string]interface{}) {
+	if o.title != "" {
+		data["title"] = o.title
+	}
+	if o.uuid != "" {
+		data["uuid"] = o.uuid
+	}
+	if !o.timestamp.IsZero() {
+		data["timestamp"] = o.timestamp.Unix()
+	}
+	if o.environment != "" {
+		data["environment"] = o.environment
+	}
+	if o.framework != "" {
+		data["framework"] = o.framework
+	}
+	if o.branch != "" {
+		if server, ok := data["server"].(map[string]interface{}); ok {
+			server["branch"] = o.branch
+		}
+	}
+	if o.stack != nil {
+		if chain := traceChain(data); len(chain) > 0 {
+			chain[0]["frames"] = o.stack
+		}
+	}
+	if o.collapseFrames {
+		for _, trace := range traceChain(data) {
+			if frames, ok := trace["frames"].(rollbar.Stack); ok {
+				trace["frames"] = collapseRecursiveFrames(frames)
+			}
+		}
+	}
+	if o.source != nil {
+		for _, trace := range traceChain(data) {
+			if frames, ok := trace["frames"].(rollbar.Stack); ok {
+				trace["frames"] = o.source.frames(frames)
+			}
+		}
+	}
+	if o.fingerprint != "" {
+		data["fingerprint"] = o.fingerprint
+	}
+	if o.person != nil {
+		data["person"] = o.person
+	}
+	if o.telemetry != nil {
+		if body, ok := data["body"].(map[string]interface{}); ok {
+			body["telemetry"] = o.telemetry
+		}
+	}
+	if o.rewrite != nil {
+		rewriteMessages(data, o.rewrite)
+	}
+}
+
+// rewriteString applies the rewrite of the occurrence, if any, to s.
+func (o *occurrence) rewriteString(s string) string {
+	if o.rewrite == nil {
+		return s
+	}
+	return o.rewrite(s)
+}
+
+// personData returns the person of an item, or nil without an id. Extra
+// attributes can't replace the id, username or email.
+func personData(id, username, email string, extra map[string]interface{}) map[string]interface{} {
+	if id == "" {
+		return nil
+	}
+	person := make(map[string]interface{}, len(extra)+3)
+	for k, v := range extra {
+		person[k] = v
+	}
+	person["id"] = id
+	if username != "" {
+		person["username"] = username
+	}
+	if email != "" {
+		person["email"] = email
+	}
+	return person
+}
+
+// traceChain returns the trace chain of an error item, or nil for messages.
+func traceChain(data map[string]interface{}) []map[string]interface{} {
+	body, _ := data["body"].(map[string]interface{})
+	chain, _ := body["trace_chain"].([]map[string]interface{})
+	return chain
+}
+
+// rewriteMessages applies fn to the title, the exception messages and the
+// message body of an item.
+func rewriteMessages(data map[string]interface{}, fn func(string) string) {
+	if title, ok := data["title"].(string); ok {
+		data["title"] = fn(title)
+	}
+	for _, trace := range traceChain(data) {
+		if exception, ok := trace["exception"].(map[string]interface{}); ok {
+			if msg, ok := exception["message"].(string); ok {
+				exception["message"] = fn(msg)
+			}
+		}
+	}
+	body, _ := data["body"].(map[string]interface{})
+	if message, ok := body["message"].(map[string]interface{}); ok {
+		if msg, ok := message["body"].(string); ok {
+			message["body"] = fn(msg)
+		}
+	}
+}
+
+// popOccurrence removes the occurrence from the custom data of an item and
+// returns it, or nil when there is none.
+func popOccurrence(data map[string]interface{}) *occurrence {
+	custom, ok := data["custom"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	o, ok := custom[occurrenceKey].(*occurrence)
+	if !ok {
+		return nil
+	}
+
+	delete(custom, occurrenceKey)
+	if len(custom) == 0 {
+		delete(data, "custom")
+	}
+	return o
+}
+
+// newUUID returns a random (version 4) UUID, or an empty string if no random
+// data is available.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,304 @@
+package rollrus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestOccurrenceUUID(t *testing.T) {
+	h := NewHook("", "testing", WithRetry(2, time.Millisecond))
+	ft := withFakeTransport(h, &fakeTransport{err: rollbar.ErrHTTPError(http.StatusBadGateway), failures: 1})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(ft.sent) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(ft.sent))
+	}
+	first := ft.sent[0]["data"].(map[string]interface{})["uuid"]
+	second := ft.sent[1]["data"].(map[string]interface{})["uuid"]
+	if s, ok := first.(string); !ok || !uuidPattern.MatchString(s) {
+		t.Fatalf("expected a v4 uuid, got %v", first)
+	}
+	if first != second {
+		t.Fatalf("expected retries to reuse the uuid, got %v and %v", first, second)
+	}
+}
+
+func TestOccurrenceUUIDFromField(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data[uuidField] = "trace-1234"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	if data["uuid"] != "trace-1234" {
+		t.Errorf("expected the uuid from the field, got %v", data["uuid"])
+	}
+	if _, exists := data["custom"].(map[string]interface{})[uuidField]; exists {
+		t.Errorf("expected %s to be removed from the custom data", uuidField)
+	}
+}
+
+func TestOccurrenceTimestamp(t *testing.T) {
+	now := time.Date(2019, 9, 23, 12, 0, 0, 0, time.UTC)
+	h := NewHook("", "testing", WithClock(fixedClock(now)))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if ts := ft.sent[0]["data"].(map[string]interface{})["timestamp"]; ts != now.Unix() {
+		t.Fatalf("expected the timestamp of the clock, got %v", ts)
+	}
+}
+
+func TestWithFramework(t *testing.T) {
+	for _, framework := range []string{"", "grpc"} {
+		h := NewHook("", "testing", WithFramework(framework))
+		ft := withFakeTransport(h, &fakeTransport{})
+
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+
+		got, exists := ft.sent[0]["data"].(map[string]interface{})["framework"]
+		if exists != (framework != "") || (exists && got != framework) {
+			t.Errorf("expected framework %q, got %v", framework, got)
+		}
+	}
+}
+
+func TestWithServerBranch(t *testing.T) {
+	for _, branch := range []string{"", "feature/payments"} {
+		h := NewHook("", "testing", WithServerBranch(branch))
+		ft := withFakeTransport(h, &fakeTransport{})
+
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+
+		server := ft.sent[0]["data"].(map[string]interface{})["server"].(map[string]interface{})
+		got, exists := server["branch"]
+		if exists != (branch != "") || (exists && got != branch) {
+			t.Errorf("expected branch %q, got %v", branch, got)
+		}
+	}
+}
+
+func TestWithPersonFunc(t *testing.T) {
+	h := NewHook("", "testing", WithPersonFunc(func(entry *logrus.Entry) (string, string, string, map[string]interface{}) {
+		id, _ := entry.Data["user"].(string)
+		return id, "alice", "", map[string]interface{}{"plan": "pro", "id": "ignored"}
+	}))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["user"] = "42"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	delete(entry.Data, "user")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	expected := map[string]interface{}{"id": "42", "username": "alice", "plan": "pro"}
+	if got := ft.sent[0]["data"].(map[string]interface{})["person"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got person %v, wanted %v", got, expected)
+	}
+	if got, exists := ft.sent[1]["data"].(map[string]interface{})["person"]; exists {
+		t.Errorf("expected no person without an id, got %v", got)
+	}
+}
+
+func TestWithSentinelGroup(t *testing.T) {
+	errTimeout := errors.New("upstream timeout")
+	errRefused := errors.New("upstream refused")
+	errBusy := errors.New("upstream busy")
+	h := NewHook("", "testing",
+		WithSentinelGroup("upstream-unavailable", errTimeout, errRefused),
+		WithSentinelGroup("upstream-busy", errBusy, errRefused),
+	)
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	for _, err := range []error{fmt.Errorf("calling api: %w", errRefused), errBusy, errors.New("other")} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Data["err"] = err
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	for i, expected := range []interface{}{"upstream-unavailable", "upstream-busy", nil} {
+		if got := ft.sent[i]["data"].(map[string]interface{})["fingerprint"]; got != expected {
+			t.Errorf("item %d: got fingerprint %v, wanted %v", i, got, expected)
+		}
+	}
+}
+
+func TestOccurrenceEnvironmentFromField(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	for _, env := range []string{"tenant-a", " ", ""} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		entry.Data[envField] = env
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	for i, expected := range []string{"tenant-a", "testing", "testing"} {
+		data := ft.sent[i]["data"].(map[string]interface{})
+		if data["environment"] != expected {
+			t.Errorf("item %d: got environment %v, wanted %q", i, data["environment"], expected)
+		}
+		if custom, ok := data["custom"].(map[string]interface{}); ok {
+			if _, exists := custom[envField]; exists {
+				t.Errorf("item %d: expected %s to be removed from the custom data", i, envField)
+			}
+		}
+	}
+}
+
+func TestWithEnvSuffixFromField(t *testing.T) {
+	h := NewHook("", "production", WithEnvSuffixFromField("pool", "-"))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	for _, data := range []logrus.Fields{
+		{"pool": "canary"},
+		{},
+		{"pool": "stable", envField: "tenant-a"},
+	} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		entry.Data = data
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	for i, expected := range []string{"production-canary", "production", "tenant-a-stable"} {
+		data := ft.sent[i]["data"].(map[string]interface{})
+		if data["environment"] != expected {
+			t.Errorf("item %d: got environment %v, wanted %q", i, data["environment"], expected)
+		}
+	}
+}
+
+func TestWithMessageTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	tmpl := "[{{.Fields.component}}] {{.Message}}: {{.Err}} ({{.Level}})"
+	h := NewHook("", "testing", WithDiagnosticWriter(&buf), WithMessageTemplate(tmpl))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "charging card"
+	entry.Data["component"] = "billing"
+	entry.Data["err"] = errors.New("declined")
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	if want := "[billing] charging card: declined (error)"; data["title"] != want {
+		t.Errorf("got title %v, wanted %q", data["title"], want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no warnings, got %q", buf.String())
+	}
+}
+
+func TestWithMessageTemplateFailures(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("", "testing", WithDiagnosticWriter(&buf), WithMessageTemplate("{{.Err.Missing}}"))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if title := ft.sent[0]["data"].(map[string]interface{})["title"]; title != "This is a test" {
+		t.Errorf("expected the default title, got %v", title)
+	}
+	if !strings.Contains(buf.String(), "rendering the message template") {
+		t.Errorf("expected a warning, got %q", buf.String())
+	}
+
+	buf.Reset()
+	h = NewHook("", "testing", WithDiagnosticWriter(&buf), WithMessageTemplate("{{.Err"))
+	if h.titleTemplate != nil || !strings.Contains(buf.String(), "WithMessageTemplate") {
+		t.Errorf("expected the template to be rejected, got %q", buf.String())
+	}
+}
+
+func TestWithGroupByFields(t *testing.T) {
+	errBusy := errors.New("busy")
+	h := NewHook("", "testing", WithGroupByFields("rpc_method", "region"), WithSentinelGroup("busy", errBusy))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	fields := []logrus.Fields{
+		{"rpc_method": "GetUser", "region": "eu", "err": errors.New("timeout 1")},
+		{"rpc_method": "GetUser", "region": "eu", "err": errors.New("timeout 2")},
+		{"rpc_method": "GetUser", "err": errors.New("timeout 3")},
+		{"rpc_method": "GetUser", "region": "eu", "err": errBusy},
+	}
+	for _, f := range fields {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Data = f
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	fingerprints := []interface{}{"*errors.errorString|GetUser|eu", "*errors.errorString|GetUser|eu", nil, "busy"}
+	for i, expected := range fingerprints {
+		if got := ft.sent[i]["data"].(map[string]interface{})["fingerprint"]; got != expected {
+			t.Errorf("item %d: got fingerprint %v, wanted %v", i, got, expected)
+		}
+	}
+}
@@ -1,20 +1,66 @@
 package rollrus
 
-import "github.com/sirupsen/logrus"
+import (
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
 
 // OptionFunc that can be passed to NewHook.
 type OptionFunc func(*Hook)
 
+// WithClient is an OptionFunc that makes the hook report through c instead of
+// a client of its own, keeping the configuration of c, such as its endpoint
+// and scrubbing. The token and environment passed to NewHook are then unused.
+// The hook takes c over rather than copying it: its transport is wrapped like
+// the one of the hook's own client, options that configure the client change c
+// itself and Close closes it. Pass WithClient before those options.
+func WithClient(c *rollbar.Client) OptionFunc {
+	return func(h *Hook) {
+		if c == nil {
+			h.warnf("WithClient needs a client, keeping the hook's own")
+			return
+		}
+		if _, ok := c.Transport.(*transport); !ok {
+			c.Transport = newTransport(h, c.Transport)
+		}
+		h.Client = c
+	}
+}
+
 // WithLevels is an OptionFunc that customizes the log.Levels the hook will
 // report on.
+//
+// WithLevels and WithMinLevel both set the levels, so when they are combined
+// the one passed last wins and a warning is printed to stderr.
 func WithLevels(levels ...logrus.Level) OptionFunc {
 	return func(h *Hook) {
-		h.triggers = levels
+		setTriggers(h, "WithLevels", levels)
+	}
+}
+
+// WithAdjustableLevels is an OptionFunc that lets logrus pass entries of all
+// levels to the hook, so that SetLevels and SetMinLevel can make it report on
+// levels it didn't report on when it was added to a logger.
+func WithAdjustableLevels() OptionFunc {
+	return func(h *Hook) {
+		h.adjustableLevels = true
 	}
 }
 
 // WithMinLevel is an OptionFunc that customizes the log.Levels the hook will
 // report on by selecting all levels more severe than the one provided.
+//
+// See WithLevels for how the two options interact.
 func WithMinLevel(level logrus.Level) OptionFunc {
 	var levels []logrus.Level
 	for _, l := range logrus.AllLevels {
@@ -24,8 +70,36 @@ func WithMinLevel(level logrus.Level) OptionFunc {
 	}
 
 	return func(h *Hook) {
-		h.triggers = levels
+		setTriggers(h, "WithMinLevel", levels)
+	}
+}
+
+// WithBlocklistLevels is an OptionFunc that customizes the log.Levels the hook
+// will report on by selecting all levels except the ones provided. Like
+// WithLevels and WithMinLevel it replaces the levels, so the last of these
+// options wins.
+func WithBlocklistLevels(levels ...logrus.Level) OptionFunc {
+	var selected []logrus.Level
+	for _, l := range logrus.AllLevels {
+		if !containsLevel(levels, l) {
+			selected = append(selected, l)
+		}
+	}
+
+	return func(h *Hook) {
+		setTriggers(h, "WithBlocklistLevels", selected)
+	}
+}
+
+// setTriggers replaces the levels of the hook, warning when they were already
+// set by a different OptionFunc. The conflict is also reported by Validate.
+func setTriggers(h *Hook, option string, levels []logrus.Level) {
+	if h.triggersSetBy != "" && h.triggersSetBy != option {
+		h.triggersConflict = option + " overrides the levels set by " + h.triggersSetBy
+		h.warnf("%s", h.triggersConflict)
 	}
+	h.triggers = levels
+	h.triggersSetBy = option
 }
 
 // WithIgnoredErrors is an OptionFunc that whitelists certain errors to prevent
@@ -36,18 +110,909 @@ func WithIgnoredErrors(errors ...error) OptionFunc {
 	}
 }
 
+// WithIgnoreContextErrors is an OptionFunc that ignores context.Canceled and
+// context.DeadlineExceeded, including errors wrapping them, in addition to the
+// errors passed to WithIgnoredErrors.
+func WithIgnoreContextErrors() OptionFunc {
+	return func(h *Hook) {
+		h.ignoreContextErrors = true
+	}
+}
+
 // WithIgnoreErrorFunc is an OptionFunc that receives the error that is about
 // to be logged and returns true/false if it wants to fire a Rollbar alert for.
+// It is kept for compatibility, WithIgnoreErrorReportFunc receives the full
+// ReportContext instead.
 func WithIgnoreErrorFunc(fn func(error) bool) OptionFunc {
+	return WithIgnoreErrorReportFunc(func(rc ReportContext) bool {
+		return fn(rc.Err)
+	})
+}
+
+// WithIgnoreErrorReportFunc is an OptionFunc that receives the ReportContext
+// of every entry that is about to be reported and returns true if it should be
+// ignored instead. Unlike WithIgnoreReportFunc it runs before the fields are
+// converted, so Extras is nil, but ignored entries are cheaper. It replaces
+// the function set by WithIgnoreErrorFunc.
+func WithIgnoreErrorReportFunc(fn func(ReportContext) bool) OptionFunc {
 	return func(h *Hook) {
 		h.ignoreErrorFunc = fn
 	}
 }
 
+// WithCountedIgnore is an OptionFunc that works like WithIgnoreErrorFunc, but
+// counts the errors that fn ignores by the label it returns along with them,
+// so that they can be followed through Stats without creating Rollbar items.
+// It is kept for compatibility, WithCountedIgnoreReport receives the full
+// ReportContext instead.
+func WithCountedIgnore(fn func(err error) (ignore bool, label string)) OptionFunc {
+	return WithCountedIgnoreReport(func(rc ReportContext) (bool, string) {
+		return fn(rc.Err)
+	})
+}
+
+// WithCountedIgnoreReport is an OptionFunc that works like
+// WithIgnoreErrorReportFunc, but counts the entries that fn ignores by the
+// label it returns along with them, see WithCountedIgnore. It replaces the
+// function set by WithCountedIgnore.
+func WithCountedIgnoreReport(fn func(rc ReportContext) (ignore bool, label string)) OptionFunc {
+	return func(h *Hook) {
+		h.countedIgnore = fn
+	}
+}
+
 // WithIgnoreFunc is an OptionFunc that receives the error and custom fields that are about
 // to be logged and returns true/false if it wants to fire a Rollbar alert for.
+// It is kept for compatibility, WithIgnoreReportFunc receives the full
+// ReportContext instead.
 func WithIgnoreFunc(fn func(err error, fields map[string]interface{}) bool) OptionFunc {
+	return WithIgnoreReportFunc(func(rc ReportContext) bool {
+		return fn(rc.Err, rc.Extras)
+	})
+}
+
+// WithIgnoreReportFunc is an OptionFunc that receives the ReportContext of
+// every entry that is about to be reported and returns true if it should be
+// ignored instead. It replaces the function set by WithIgnoreFunc.
+func WithIgnoreReportFunc(fn func(ReportContext) bool) OptionFunc {
 	return func(h *Hook) {
 		h.ignoreFunc = fn
 	}
 }
+
+// WithTags is an OptionFunc that attaches the given tags to every report. Tags
+// can also be added to a single entry with the rollbar_tags field, either as a
+// []string or as a comma separated string.
+func WithTags(tags ...string) OptionFunc {
+	return func(h *Hook) {
+		h.tags = append(h.tags, tags...)
+	}
+}
+
+// WithDynamicMinLevel is an OptionFunc that further restricts the levels the
+// hook will report on to those at least as severe as the level returned by fn.
+// fn is called for every entry, so the threshold can be changed at runtime, for
+// example based on an environment variable.
+//
+// logrus caches the result of Levels() when the hook is added, so with this
+// option Levels() returns all levels and the filtering happens in Fire.
+func WithDynamicMinLevel(fn func() logrus.Level) OptionFunc {
+	return func(h *Hook) {
+		h.dynamicMinLevel = fn
+	}
+}
+
+// WithoutSyntheticFields is an OptionFunc that stops the hook from adding the
+// time and msg extras, which duplicate Rollbar's own timestamp and title.
+func WithoutSyntheticFields() OptionFunc {
+	return func(h *Hook) {
+		h.omitSyntheticFields = true
+	}
+}
+
+// WithRetry is an OptionFunc that makes the hook try sending a report up to
+// attempts times, waiting backoff before the first retry and doubling the wait
+// after every further failure. Failures that can't be resolved by retrying,
+// such as an invalid token, are not retried. The retries of the rollbar client
+// itself are disabled in favor of this. It only applies to synchronous
+// clients: an asynchronous one, see WithAsync, keeps retrying temporary
+// network errors itself, as its failures never reach the hook.
+func WithRetry(attempts int, backoff time.Duration) OptionFunc {
+	return func(h *Hook) {
+		h.retryAttempts = attempts
+		h.retryBackoff = backoff
+		if h.Client == nil {
+			return
+		}
+		if t, ok := h.Client.Transport.(*transport); ok && t.async() {
+			return
+		}
+		h.Client.SetRetryAttempts(0)
+	}
+}
+
+// WithOnError is an OptionFunc that registers fn to be called whenever rollrus
+// itself fails, for example when a report can't be sent to Rollbar. fn must not
+// log through a logger this hook is attached to at a level the hook reports,
+// otherwise every failure will trigger another report.
+func WithOnError(fn func(err error)) OptionFunc {
+	return func(h *Hook) {
+		h.onError = fn
+	}
+}
+
+// WithErrorHandler is an OptionFunc that registers fn to be called with the
+// entry and the error whenever an item reported for an entry can't be sent to
+// Rollbar after all retries, for example to alert through another channel.
+// With an asynchronous client fn only learns about items dropped because the
+// queue is full, as rollbar's asynchronous transport doesn't return the
+// errors of sending. Like for WithOnError, fn must not log through a logger this hook is
+// attached to at a level the hook reports.
+func WithErrorHandler(fn func(entry *logrus.Entry, err error)) OptionFunc {
+	return func(h *Hook) {
+		h.errorHandler = fn
+	}
+}
+
+// WithPropagateErrors is an OptionFunc that makes Fire return the error of
+// sending a report, or why it was dropped, like ErrRateLimited, so that logrus
+// prints it to stderr. Errors of batched reports and of reports sent through
+// an asynchronous client, other than a full queue, aren't known by the time
+// Fire returns and are not propagated.
+func WithPropagateErrors() OptionFunc {
+	return func(h *Hook) {
+		h.propagateErrors = true
+	}
+}
+
+// WithSkipOnCanceledContext is an OptionFunc that skips reporting entries whose
+// context is already canceled or past its deadline, such as errors caused by an
+// aborted request. Entries without a context are reported as usual.
+func WithSkipOnCanceledContext() OptionFunc {
+	return func(h *Hook) {
+		h.skipOnCanceledContext = true
+	}
+}
+
+// WithBatching is an OptionFunc that coalesces identical reports, sending each
+// of them at most once per interval with an occurrence_count extra. Fatal and
+// Panic entries are always sent right away. Call Close on the hook to send the
+// pending reports before exiting.
+func WithBatching(interval time.Duration) OptionFunc {
+	return func(h *Hook) {
+		if interval <= 0 {
+			h.warnf("WithBatching needs a positive interval, got %v", interval)
+			return
+		}
+		h.batch = newBatcher(h, interval)
+	}
+}
+
+// WithStackExtractor is an OptionFunc that customizes how the stack trace
+// carried by an error is found. When fn returns frames they are reported
+// instead of the stack of the logging call. By default the stack recorded by
+// github.com/pkg/errors is used.
+func WithStackExtractor(fn func(error) []runtime.Frame) OptionFunc {
+	return func(h *Hook) {
+		h.stackExtractor = fn
+	}
+}
+
+// WithObserveLevels is an OptionFunc that makes the hook receive entries of the
+// given levels from logrus in addition to the ones it reports on. Entries of
+// these levels are not reported to Rollbar, but sent as telemetry with the
+// next items, see Hook.Observe.
+func WithObserveLevels(levels ...logrus.Level) OptionFunc {
+	return func(h *Hook) {
+		h.observeLevels = append(h.observeLevels, levels...)
+	}
+}
+
+// WithClock is an OptionFunc that replaces the clock used by the hook for
+// everything time dependent, like timestamps of entries without a time and the
+// waits of WithRetry and WithBatching.
+func WithClock(c Clock) OptionFunc {
+	return func(h *Hook) {
+		h.clock = c
+	}
+}
+
+// WithCallerInfo is an OptionFunc that adds the name of the function that
+// logged the entry and the ID of its goroutine as the caller and goroutine
+// extras. This walks the stack for every report, so it is off by default.
+func WithCallerInfo() OptionFunc {
+	return func(h *Hook) {
+		h.callerInfo = true
+	}
+}
+
+// WithLevelFilter is an OptionFunc that registers fn to decide whether entries
+// of a level are reported. It is consulted in Fire, so it can only exclude
+// levels: the levels configured with WithLevels or WithMinLevel must still
+// include every level fn may accept, or logrus won't pass those entries to
+// the hook.
+func WithLevelFilter(fn func(logrus.Level) bool) OptionFunc {
+	return func(h *Hook) {
+		h.levelFilter = fn
+	}
+}
+
+// WithFieldFormatter is an OptionFunc that lets fn decide how the value of each
+// field is reported. When fn returns false the field is converted as usual,
+// which for values that are both an error and a fmt.Stringer means using the
+// error message.
+func WithFieldFormatter(fn func(key string, value interface{}) (interface{}, bool)) OptionFunc {
+	return func(h *Hook) {
+		h.fieldFormatter = fn
+	}
+}
+
+// WithLevelsByEnv is an OptionFunc that customizes the log.Levels the hook will
+// report on based on the environment of the hook. Environments are matched
+// case-insensitively and the "*" key is used for all other environments. When
+// nothing matches the levels are left unchanged. Like WithLevels, it overrides
+// previously set levels.
+func WithLevelsByEnv(levels map[string][]logrus.Level) OptionFunc {
+	return func(h *Hook) {
+		var env string
+		if h.Client != nil {
+			env = h.Client.Environment()
+		}
+
+		selected, ok := levels["*"]
+		for e, l := range levels {
+			if e != "*" && strings.EqualFold(e, env) {
+				selected, ok = l, true
+				break
+			}
+		}
+		if ok {
+			setTriggers(h, "WithLevelsByEnv", selected)
+		}
+	}
+}
+
+// WithoutStackTraceForWarnings is an OptionFunc that reports Warn entries as
+// Rollbar messages with the error message as body instead of as errors with a
+// stack trace. This also avoids walking the stack for every warning.
+func WithoutStackTraceForWarnings() OptionFunc {
+	return func(h *Hook) {
+		h.omitWarningStack = true
+	}
+}
+
+// WithExtrasFromEnv is an OptionFunc that reads the given environment variables
+// once and adds the non-empty ones to the extras of every report, named after
+// the variable. Fields of the entry take precedence.
+func WithExtrasFromEnv(vars ...string) OptionFunc {
+	return func(h *Hook) {
+		for _, name := range vars {
+			if v := os.Getenv(name); v != "" {
+				if h.extras == nil {
+					h.extras = make(map[string]interface{})
+				}
+				h.extras[name] = v
+			}
+		}
+	}
+}
+
+// WithCustom is an OptionFunc that adds the given custom data, such as the
+// region or service name, to the extras of every report. The map is copied.
+// Fields of the entry take precedence.
+func WithCustom(custom map[string]interface{}) OptionFunc {
+	return func(h *Hook) {
+		for k, v := range custom {
+			if h.extras == nil {
+				h.extras = make(map[string]interface{}, len(custom))
+			}
+			h.extras[k] = v
+		}
+	}
+}
+
+// WithSkipIf is an OptionFunc that registers fn to be called with every entry
+// before any other work is done. Entries for which it returns true are dropped,
+// which makes it the cheapest way to ignore entries.
+func WithSkipIf(fn func(entry *logrus.Entry) bool) OptionFunc {
+	return func(h *Hook) {
+		h.skipIf = fn
+	}
+}
+
+// WithConcurrencyLimit is an OptionFunc that limits the number of reports being
+// sent at the same time to n. When the limit is reached a report waits up to
+// wait for another one to finish and is then dropped, passing
+// ErrConcurrencyLimit to the WithOnError callback. Fatal and Panic entries
+// always wait.
+func WithConcurrencyLimit(n int, wait time.Duration) OptionFunc {
+	return func(h *Hook) {
+		if n > 0 {
+			h.sem = make(chan struct{}, n)
+		}
+		h.semWait = wait
+	}
+}
+
+// WithFramework is an OptionFunc that sets the framework reported with every
+// item, such as "gin" or "grpc".
+func WithFramework(name string) OptionFunc {
+	return func(h *Hook) {
+		h.framework = name
+	}
+}
+
+// WithScrubFields is an OptionFunc that replaces the values of the extras and
+// request parameters whose names contain any of the given ones, such as
+// "password", with [FILTERED], matching case-insensitively. The names add to
+// rollbar's default of password, secret and token.
+func WithScrubFields(fields ...string) OptionFunc {
+	return func(h *Hook) {
+		re := scrubPattern(append(append([]string(nil), defaultScrubFields...), fields...))
+		h.scrubFields = re
+		h.Client.SetScrubFields(re)
+	}
+}
+
+// WithScrubHeaders is an OptionFunc that scrubs the request headers whose names
+// contain any of the given ones, such as "X-Api-Key", matching
+// case-insensitively, in addition to the Authorization and Cookie headers.
+func WithScrubHeaders(headers ...string) OptionFunc {
+	return func(h *Hook) {
+		h.Client.SetScrubHeaders(scrubPattern(append([]string{"Authorization", "Cookie"}, headers...)))
+	}
+}
+
+// WithRedactURLQueryParams is an OptionFunc that replaces the values of the
+// given query parameters in URLs found in the message, the error and the string
+// extras of a report, leaving the rest of the URL intact. Parameter names are
+// matched case-insensitively. Without parameters token, signature, sig and key
+// are redacted.
+func WithRedactURLQueryParams(params ...string) OptionFunc {
+	if len(params) == 0 {
+		params = defaultRedactedParams
+	}
+
+	return func(h *Hook) {
+		if h.redactParams == nil {
+			h.redactParams = make(map[string]bool, len(params))
+		}
+		for _, p := range params {
+			h.redactParams[strings.ToLower(p)] = true
+		}
+	}
+}
+
+// WithItemCustomizer is an OptionFunc that merges the map returned by fn into
+// the custom data of every report right before it is sent, replacing extras of
+// the same name. fn receives the level, the cause of the error and the extras
+// about to be reported, which it must not modify. It runs after redaction, so
+// it can deliberately add back data that WithRedactURLQueryParams would remove.
+func WithItemCustomizer(
+	fn func(level logrus.Level, err error, extras map[string]interface{}) map[string]interface{}) OptionFunc {
+	return func(h *Hook) {
+		h.itemCustomizer = fn
+	}
+}
+
+// WithProjectRouter is an OptionFunc that reports entries through the client
+// registered in routes for the string value of their fieldKey field, for
+// example to send the errors of each tenant to its own Rollbar project. Other
+// entries use the hook's client. The field isn't reported and Close leaves the
+// clients open.
+func WithProjectRouter(routes map[string]*rollbar.Client, fieldKey string) OptionFunc {
+	return func(h *Hook) {
+		h.projectRoutes = make(map[string]*rollbar.Client, len(routes))
+		for v, c := range routes {
+			if c == nil {
+				continue
+			}
+			if _, ok := c.Transport.(*transport); !ok {
+				c.Transport = newTransport(h, c.Transport)
+			}
+			h.projectRoutes[v] = c
+		}
+		h.projectField = fieldKey
+	}
+}
+
+// WithAdditionalClients is an OptionFunc that also reports every entry through
+// the given clients, for example to mirror errors to a shared project of the
+// platform team. Close leaves the clients open.
+func WithAdditionalClients(clients ...*rollbar.Client) OptionFunc {
+	return func(h *Hook) {
+		for _, c := range clients {
+			if c == nil {
+				continue
+			}
+			if _, ok := c.Transport.(*transport); !ok {
+				c.Transport = newTransport(h, c.Transport)
+			}
+			h.additionalClients = append(h.additionalClients, c)
+		}
+	}
+}
+
+// WithLevelTokens is an OptionFunc that reports the entries of the given
+// levels with other access tokens, for example to send panics and fatal
+// errors to a Rollbar project that pages someone. The hook creates a client
+// for each token when it is first used, with the settings of the hook's
+// client, and closes them in Close. Levels without a token are reported with
+// the hook's client. WithProjectRouter takes precedence.
+func WithLevelTokens(tokens map[logrus.Level]string) OptionFunc {
+	return func(h *Hook) {
+		h.levelTokens = make(map[logrus.Level]string, len(tokens))
+		for l, token := range tokens {
+			h.levelTokens[l] = token
+		}
+	}
+}
+
+// WithTokenRouter is an OptionFunc that reports each entry with the access
+// token returned by fn, for example to send the errors of each tenant to its
+// own Rollbar project based on a field. Entries for which fn returns the
+// empty string are reported as usual. Clients are created for the tokens like
+// for WithLevelTokens, and kept until Close, so fn should only return a
+// bounded set of tokens. It takes precedence over WithLevelTokens, but not
+// over WithProjectRouter.
+func WithTokenRouter(fn func(entry *logrus.Entry) string) OptionFunc {
+	return func(h *Hook) {
+		h.tokenRouter = fn
+	}
+}
+
+// WithEnabledEnvironments is an OptionFunc that turns the hook into a no-op
+// unless the environment of its client is one of envs, for example to report
+// only from production and staging but not from laptops. Entries are counted
+// as Suppressed in Stats like while the hook is disabled by Disable. The
+// environment is checked again by SetEnvironment.
+func WithEnabledEnvironments(envs ...string) OptionFunc {
+	return func(h *Hook) {
+		h.enabledEnvs = make(map[string]bool, len(envs))
+		for _, env := range envs {
+			h.enabledEnvs[env] = true
+		}
+		if h.Client != nil {
+			h.checkEnvironment(h.Client.Environment())
+		}
+	}
+}
+
+// WithEnvSuffixFromField is an OptionFunc that appends sep and the value of the
+// key field of an entry to the environment it is reported under, for example
+// "production-canary" for a pool field of "canary" and a sep of "-". Entries
+// without the field are reported under the environment unchanged. The suffix
+// is also appended to an environment set by the rollbar_env field.
+func WithEnvSuffixFromField(key, sep string) OptionFunc {
+	return func(h *Hook) {
+		h.envSuffixField = key
+		h.envSuffixSep = sep
+	}
+}
+
+// WithEndpoint is an OptionFunc that sends items to endpoint instead of
+// rollbar.DefaultEndpoint, for example to a relay in front of the Rollbar API.
+// The endpoint is the full URL items are posted to, such as
+// "https://rollbar-relay.internal/api/1/item/".
+func WithEndpoint(endpoint string) OptionFunc {
+	return func(h *Hook) {
+		h.Client.SetEndpoint(endpoint)
+	}
+}
+
+// WithHTTPClient is an OptionFunc that sends items and pings with client
+// instead of http.DefaultClient, for example to configure a proxy or timeouts.
+// Items are then sent synchronously, so it can't be combined with WithAsync.
+func WithHTTPClient(client *http.Client) OptionFunc {
+	return func(h *Hook) {
+		t, ok := h.Client.Transport.(*transport)
+		if !ok || client == nil {
+			h.warnf("WithHTTPClient needs a client and a hook created by NewHook")
+			return
+		}
+		t.setHTTPClient(h.Client.Token(), h.Client.Endpoint(), client)
+		h.httpClient = client
+	}
+}
+
+// WithPlatform is an OptionFunc that sets the platform reported with every
+// item, such as "heroku" or "kubernetes", instead of runtime.GOOS.
+func WithPlatform(platform string) OptionFunc {
+	return func(h *Hook) {
+		h.Client.SetPlatform(platform)
+	}
+}
+
+// WithCodeVersion is an OptionFunc that sets the code_version reported with
+// every item, such as the git SHA of the running build, so that Rollbar can
+// link occurrences to the source.
+func WithCodeVersion(version string) OptionFunc {
+	return func(h *Hook) {
+		h.Client.SetCodeVersion(version)
+	}
+}
+
+// WithServerHost is an OptionFunc that sets the server.host reported with
+// every item, such as the hostname of the machine.
+func WithServerHost(host string) OptionFunc {
+	return func(h *Hook) {
+		h.Client.SetServerHost(host)
+	}
+}
+
+// WithServerRoot is an OptionFunc that sets the server.root reported with
+// every item, the path to the application code without a trailing slash,
+// which Rollbar uses to tell project frames from others.
+func WithServerRoot(root string) OptionFunc {
+	return func(h *Hook) {
+		h.Client.SetServerRoot(root)
+	}
+}
+
+// WithServerBranch is an OptionFunc that sets the server.branch reported with
+// every item, such as the branch the running build was made from.
+func WithServerBranch(branch string) OptionFunc {
+	return func(h *Hook) {
+		h.serverBranch = branch
+	}
+}
+
+// WithDiagnosticWriter is an OptionFunc that makes the hook and its rollbar
+// client write their own diagnostics, like dropped reports or failures to
+// reach Rollbar, to w instead of stderr. w must not be a logger this hook is
+// attached to.
+func WithDiagnosticWriter(w io.Writer) OptionFunc {
+	return func(h *Hook) {
+		h.diagnostics = w
+		if h.Client != nil {
+			h.Client.SetLogger(writerLogger{w: w})
+		}
+	}
+}
+
+// WithLogger is an OptionFunc that makes the hook and its rollbar client log
+// their own diagnostics, like failures to reach Rollbar, retries and dropped
+// reports, to l, replacing WithDiagnosticWriter. Failures and drops are logged
+// as warnings, retries as info. The entries carry a rollrus_diagnostic field
+// and are never reported by rollrus hooks, so the hook may be attached to l.
+// l must not be the logger an entry is reported from though, as logrus would
+// deadlock logging from within its own hooks, so use a separate logger.
+func WithLogger(l logrus.FieldLogger) OptionFunc {
+	return func(h *Hook) {
+		h.logger = l
+		if h.Client != nil {
+			h.Client.SetLogger(fieldLogger{l: l})
+		}
+	}
+}
+
+// WithLevelForErrorType is an OptionFunc that reports errors matching target
+// with the Rollbar severity level, like rollbar.WARN, instead of the one
+// derived from the logrus level. Errors are matched with errors.As, so target
+// must be a non-nil pointer to an error type or an interface, as for
+// errors.As. Rules are checked in the order they were added and the first
+// match wins. Critical reports are never overridden.
+func WithLevelForErrorType(target interface{}, level string) OptionFunc {
+	return func(h *Hook) {
+		t := reflect.TypeOf(target)
+		if t == nil || t.Kind() != reflect.Ptr || reflect.ValueOf(target).IsNil() {
+			h.warnf("WithLevelForErrorType needs a non-nil pointer, got %T", target)
+			return
+		}
+		if e := t.Elem(); e.Kind() != reflect.Interface && !e.Implements(errorType) {
+			h.warnf("WithLevelForErrorType needs a pointer to an error type or interface, got %T", target)
+			return
+		}
+		severity := strings.ToLower(level)
+		if !validSeverities[severity] {
+			h.warnf("WithLevelForErrorType needs a Rollbar level like %q, got %q", rollbar.WARN, level)
+			return
+		}
+		h.errorTypeLevels = append(h.errorTypeLevels, errorTypeLevel{typ: t.Elem(), severity: severity})
+	}
+}
+
+// WithDropIfNoError is an OptionFunc that skips entries without an error in
+// one of the well known error fields, err or error, instead of reporting their
+// message as the error. Only entries logged with an error, like
+// log.WithError(err).Error(...), are reported then.
+func WithDropIfNoError() OptionFunc {
+	return func(h *Hook) {
+		h.dropIfNoError = true
+	}
+}
+
+// defaultErrorCauseField is the extra used by WithErrorCauseField when no key
+// is given.
+const defaultErrorCauseField = "root_cause"
+
+// WithErrorCauseField is an OptionFunc that reports the message of the
+// innermost error, found by following errors.Unwrap or Cause, as the key
+// extra, or root_cause if key is empty. Fields of the entry with that name
+// take precedence. Chains are followed at most 100 errors deep, which also
+// ends cyclic ones.
+func WithErrorCauseField(key string) OptionFunc {
+	if key == "" {
+		key = defaultErrorCauseField
+	}
+	return func(h *Hook) {
+		h.causeField = key
+	}
+}
+
+// WithMaxMessageLength is an OptionFunc that truncates the msg extra to n
+// characters, followed by an ellipsis, instead of the default 1024. A negative
+// n disables the truncation. The message used as the title of the item is not
+// affected.
+func WithMaxMessageLength(n int) OptionFunc {
+	return func(h *Hook) {
+		h.maxMessageLength = n
+	}
+}
+
+// WithReportChannel is an OptionFunc that sends a copy of every report to ch
+// in addition to Rollbar, for example to also log them locally. Reports are
+// dropped when ch is full, so the hook never blocks on it.
+func WithReportChannel(ch chan<- Report) OptionFunc {
+	return func(h *Hook) {
+		h.reports = ch
+	}
+}
+
+// WithPanicStackDepth is an OptionFunc that limits the stack traces reported
+// by Hook.ReportPanicWithPrefix to the n innermost frames, starting at the
+// function that panicked.
+func WithPanicStackDepth(n int) OptionFunc {
+	return func(h *Hook) {
+		h.panicStackDepth = n
+	}
+}
+
+// WithItemsPerMinuteLimit is an OptionFunc that limits the number of items
+// reported to n per minute, for example to stay within the limit of the
+// Rollbar account. Up to n items can be reported at once, after that reports
+// are dropped until the limit allows for another one, which then carries the
+// number of dropped reports as the dropped_due_to_rate_limit extra. Fatal and
+// Panic entries are always reported. A n of 0 or less removes the limit.
+func WithItemsPerMinuteLimit(n int) OptionFunc {
+	return func(h *Hook) {
+		if n <= 0 {
+			h.limiter = nil
+			return
+		}
+		h.limiter = newRateLimiter(n)
+	}
+}
+
+// WithFieldKeyRename is an OptionFunc that renames fields before they are
+// reported, mapping each key of mapping to its value, for example to report
+// userID and uid both as user_id. When an entry has several fields that end up
+// with the same name the renamed one whose original name sorts last wins, and
+// a warning about such mappings is printed when the option is applied.
+func WithFieldKeyRename(mapping map[string]string) OptionFunc {
+	from := make([]string, 0, len(mapping))
+	for k, v := range mapping {
+		if k != v {
+			from = append(from, k)
+		}
+	}
+	sort.Strings(from)
+
+	return func(h *Hook) {
+		sources := make(map[string][]string)
+		for _, k := range from {
+			to := mapping[k]
+			sources[to] = append(sources[to], k)
+			h.keyRenames = append(h.keyRenames, keyRename{from: k, to: to})
+		}
+		for _, to := range sortedKeys(sources) {
+			if keys := sources[to]; len(keys) > 1 {
+				h.warnf("WithFieldKeyRename maps %s to %s, %s wins when several are set",
+					strings.Join(keys, ", "), to, keys[len(keys)-1])
+			}
+		}
+	}
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WithPersonFunc is an OptionFunc that calls fn for every report to find the
+// person affected by it, for example from a user stored in the context of the
+// entry. When fn returns an id, the person is reported with the item along
+// with the username, email and extra attributes, replacing any person set on
+// the client.
+func WithPersonFunc(
+	fn func(entry *logrus.Entry) (id, username, email string, extra map[string]interface{})) OptionFunc {
+	return func(h *Hook) {
+		h.personFunc = fn
+	}
+}
+
+// WithSentinelGroup is an OptionFunc that groups all errors matching one of
+// errs, according to errors.Is, into a single Rollbar item by using name as
+// their fingerprint. Groups are checked in the order they were added and the
+// first match wins.
+func WithSentinelGroup(name string, errs ...error) OptionFunc {
+	return func(h *Hook) {
+		h.sentinelGroups = append(h.sentinelGroups, sentinelGroup{name: name, errs: errs})
+	}
+}
+
+// WithBuildInfo is an OptionFunc that reads the build info embedded by Go once
+// and adds the version of the main module and the VCS revision it was built
+// from as the module_version and vcs_revision extras. The revision is also used
+// as the code version, unless one was set on the client already. Nothing is
+// added when the build info isn't available, such as with go run.
+func WithBuildInfo() OptionFunc {
+	return func(h *Hook) {
+		version, revision, _ := buildInfo()
+		for k, v := range map[string]string{"module_version": version, "vcs_revision": revision} {
+			if v == "" {
+				continue
+			}
+			if h.extras == nil {
+				h.extras = make(map[string]interface{})
+			}
+			h.extras[k] = v
+		}
+		if revision != "" && h.Client != nil && h.Client.CodeVersion() == "" {
+			h.Client.SetCodeVersion(revision)
+		}
+	}
+}
+
+// WithBuildInfoCodeVersion is an OptionFunc that sets the code version of the
+// hook's client to the VCS revision recorded in the build info, replacing any
+// code version set before. Builds from a modified working tree are reported
+// with a vcs_modified extra of true. Nothing is changed when the revision isn't
+// known, such as with go run or Go versions before 1.18.
+func WithBuildInfoCodeVersion() OptionFunc {
+	return func(h *Hook) {
+		_, revision, modified := buildInfo()
+		if revision == "" {
+			return
+		}
+		h.Client.SetCodeVersion(revision)
+		if modified {
+			if h.extras == nil {
+				h.extras = make(map[string]interface{})
+			}
+			h.extras["vcs_modified"] = true
+		}
+	}
+}
+
+// WithDryRun is an OptionFunc that writes every report to w as indented JSON
+// instead of sending it to Rollbar, with its severity, error, message, time,
+// extras and fingerprint. All the other options still apply, so it shows what
+// would be reported.
+func WithDryRun(w io.Writer) OptionFunc {
+	return func(h *Hook) {
+		h.dryRun = w
+	}
+}
+
+// WithCollapseRecursiveFrames is an OptionFunc that collapses runs of identical
+// consecutive frames in reported stack traces, as left by deep recursion, into
+// a single frame whose method notes how often it was repeated.
+func WithCollapseRecursiveFrames() OptionFunc {
+	return func(h *Hook) {
+		h.collapseFrames = true
+	}
+}
+
+// WithMessageTemplate is an OptionFunc that renders the title of every item
+// with the text/template tmpl, which is executed with a TitleData, for example
+// "[{{.Fields.component}}] {{.Message}}: {{.Err}}". When the template can't be
+// executed the default title is kept and a warning is printed. Templates that
+// can't be parsed are ignored with a warning.
+func WithMessageTemplate(tmpl string) OptionFunc {
+	t, err := template.New("message").Parse(tmpl)
+	return func(h *Hook) {
+		if err != nil {
+			h.warnf("WithMessageTemplate: %v", err)
+			return
+		}
+		h.titleTemplate = t
+	}
+}
+
+// WithRecentLogs is an OptionFunc that attaches the last n entries that weren't
+// reported to the next report, as the recent_logs extra with the level,
+// message and time of each. Attached logs are cleared, so each of them is
+// reported at most once. The hook is then passed entries of all levels by
+// logrus, but still only reports the configured ones.
+func WithRecentLogs(n int) OptionFunc {
+	return func(h *Hook) {
+		h.recentLogsSize = n
+	}
+}
+
+// WithSourceContext is an OptionFunc that adds the source code around the
+// innermost frames of reported stack traces, with the given number of lines
+// before and after each, so Rollbar can show it. Files are looked up below
+// root, first with their full reported path, like
+// github.com/user/repo/main.go, and then with leading directories removed.
+// They are read once and frames whose files can't be found, as in images
+// without sources, are reported without context. lines must not be negative.
+func WithSourceContext(root string, lines int) OptionFunc {
+	return func(h *Hook) {
+		if lines < 0 {
+			h.warnf("WithSourceContext needs a non-negative number of lines, got %d", lines)
+			return
+		}
+		h.source = newSourceContext(root, lines)
+	}
+}
+
+// WithAsyncBufferSize is an OptionFunc that makes the hook's client send items
+// asynchronously, queueing up to n of them, which must be positive. Fatal and
+// Panic entries still wait for the queue to drain, and items that don't fit
+// into it are dropped with a warning.
+func WithAsyncBufferSize(n int) OptionFunc {
+	return func(h *Hook) {
+		if n <= 0 {
+			h.warnf("WithAsyncBufferSize needs a positive size, got %d, sending synchronously", n)
+			return
+		}
+		t, ok := h.Client.Transport.(*transport)
+		if !ok {
+			h.warnf("WithAsyncBufferSize needs a hook created by NewHook")
+			return
+		}
+		t.setAsync(h.Client.Token(), h.Client.Endpoint(), n)
+	}
+}
+
+// WithAsync is an OptionFunc that makes Fire return without waiting for Rollbar
+// by sending items asynchronously, like WithAsyncBufferSize. A bufferSize of
+// zero or less queues up to rollbar.DefaultBuffer items. Call Close before the
+// process exits to wait for the queued items to be sent.
+func WithAsync(bufferSize int) OptionFunc {
+	if bufferSize <= 0 {
+		bufferSize = rollbar.DefaultBuffer
+	}
+	return WithAsyncBufferSize(bufferSize)
+}
+
+// WithShutdownTimeout is an OptionFunc that limits how long Close and Wait
+// block waiting for reports to be sent. Reports still pending after d may be
+// lost when the process exits.
+func WithShutdownTimeout(d time.Duration) OptionFunc {
+	return func(h *Hook) {
+		h.shutdownTimeout = d
+	}
+}
+
+// WithGroupByFields is an OptionFunc that groups reports into Rollbar items by
+// the type of their error and the values of the given fields, for example one
+// item per rpc_method, by setting the fingerprint from them. Reports lacking
+// one of the fields are grouped as usual. WithSentinelGroup takes precedence.
+func WithGroupByFields(keys ...string) OptionFunc {
+	return func(h *Hook) {
+		h.groupByFields = keys
+	}
+}
+
+// WithFieldAllowlist is an OptionFunc that only reports the fields of an entry
+// with one of the given keys as extras and drops all others. It is applied
+// after WithFieldKeyRename, so keys must be the new names, and before any
+// scrubbing, which still applies to the fields that are kept. The extras added
+// by rollrus itself, like time and msg, are not affected.
+func WithFieldAllowlist(keys ...string) OptionFunc {
+	return func(h *Hook) {
+		if h.fieldAllowlist == nil {
+			h.fieldAllowlist = make(map[string]bool, len(keys))
+		}
+		for _, k := range keys {
+			h.fieldAllowlist[k] = true
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package rollrus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/rollbar/rollbar-go"
+)
+
+// pingFingerprint groups all items sent by Ping into a single Rollbar item.
+const pingFingerprint = "rollrus-ping"
+
+// ErrNoToken is returned by Ping when the hook's client has no access token.
+var ErrNoToken = errors.New("rollrus: no access token configured")
+
+// Ping sends a debug item to Rollbar to verify that the hook's token,
+// environment and endpoint work, for example at startup. It returns nil if
+// Rollbar accepted the item and otherwise the error, which is a
+// rollbar.ErrHTTPError if Rollbar rejected it. All pings are grouped into one
+// item titled "rollrus ping" with a rollrus_ping custom field, so they don't
+// clutter the dashboard. Unlike reports, pings bypass the hook's transport
+// and are sent right away, honoring ctx, with the client of WithHTTPClient, if
+// any.
+func (r *Hook) Ping(ctx context.Context) error {
+	if r.Client == nil {
+		return errNoClient
+	}
+	r.clientLock().RLock()
+	token, env, endpoint := r.Client.Token(), r.Client.Environment(), r.Client.Endpoint()
+	r.clientLock().RUnlock()
+	if token == "" {
+		return ErrNoToken
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"access_token": token,
+		"data": map[string]interface{}{
+			"environment": env,
+			"title":       "rollrus ping",
+			"level":       rollbar.DEBUG,
+			"timestamp":   r.now().Unix(),
+			"platform":    r.Client.Platform(),
+			"language":    "go",
+			"fingerprint": pingFingerprint,
+			"body": map[string]interface{}{
+				"message": map[string]interface{}{"body": "rollrus ping"},
+			},
+			"custom": map[string]interface{}{"rollrus_ping": true},
+			"notifier": map[string]interface{}{
+				"name":    rollbar.NAME,
+				"version": rollbar.VERSION,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := http.DefaultClient
+	if r.httpClient != nil {
+		client = r.httpClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return rollbar.ErrHTTPError(resp.StatusCode)
+	}
+	return nil
+}
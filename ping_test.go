@@ -0,0 +1,57 @@
+package rollrus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rollbar "github.com/rollbar/rollbar-go"
+)
+
+func TestPing(t *testing.T) {
+	var got map[string]interface{}
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error("unexpected error ", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	h := NewHook("some-token", "testing")
+	h.Client.SetEndpoint(ts.URL)
+
+	if err := h.Ping(context.Background()); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if got["access_token"] != "some-token" {
+		t.Errorf("expected the token to be sent, got %v", got["access_token"])
+	}
+	data := got["data"].(map[string]interface{})
+	if data["level"] != "debug" || data["environment"] != "testing" || data["fingerprint"] != pingFingerprint {
+		t.Errorf("unexpected ping item %v", data)
+	}
+	if h.reported {
+		t.Error("expected a ping not to count as a report")
+	}
+
+	status = http.StatusUnauthorized
+	if err := h.Ping(context.Background()); err != rollbar.ErrHTTPError(http.StatusUnauthorized) {
+		t.Errorf("expected the HTTP status as error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Ping(ctx); err == nil {
+		t.Error("expected an error for a canceled context")
+	}
+}
+
+func TestPingNoToken(t *testing.T) {
+	if err := NewHook("", "testing").Ping(context.Background()); err != ErrNoToken {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+}
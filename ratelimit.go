@@ -0,0 +1,47 @@
+package rollrus
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing a number of items per minute, with
+// bursts of up to that many items.
+type rateLimiter struct {
+	perMinute float64
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	dropped uint64
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{perMinute: float64(perMinute), tokens: float64(perMinute)}
+}
+
+// allow reports whether an item may be sent at now. When it may, it also
+// returns the number of items dropped since the last allowed one.
+func (l *rateLimiter) allow(now time.Time) (bool, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Minutes() * l.perMinute
+		if l.tokens > l.perMinute {
+			l.tokens = l.perMinute
+		}
+	}
+	if l.last.IsZero() || now.After(l.last) {
+		l.last = now
+	}
+
+	if l.tokens < 1 {
+		l.dropped++
+		return false, 0
+	}
+	l.tokens--
+	dropped := l.dropped
+	l.dropped = 0
+	return true, dropped
+}
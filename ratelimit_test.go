@@ -0,0 +1,82 @@
+package rollrus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// manualClock is a Clock that only moves when told to.
+type manualClock struct {
+	t time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.t
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func (c *manualClock) NewTicker(time.Duration) Ticker {
+	return fakeTicker(nil)
+}
+
+func TestWithItemsPerMinuteLimit(t *testing.T) {
+	clock := &manualClock{t: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	var failures []error
+	h := NewHook("", "testing", WithItemsPerMinuteLimit(2), WithClock(clock), WithOnError(func(err error) {
+		failures = append(failures, err)
+	}))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	fire := func(level logrus.Level) {
+		entry := logrus.NewEntry(nil)
+		entry.Level = level
+		entry.Message = "This is a test"
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		fire(logrus.ErrorLevel)
+	}
+	fire(logrus.FatalLevel)
+	if len(ft.sent) != 3 {
+		t.Fatalf("expected 2 items and the fatal one, got %d", len(ft.sent))
+	}
+	if len(failures) != 3 || failures[0] != ErrRateLimited {
+		t.Fatalf("expected 3 rate limited reports, got %v", failures)
+	}
+
+	clock.t = clock.t.Add(30 * time.Second)
+	fire(logrus.ErrorLevel)
+	fire(logrus.ErrorLevel)
+	if len(ft.sent) != 4 {
+		t.Fatalf("expected one more item after half a minute, got %d", len(ft.sent))
+	}
+	custom := ft.sent[3]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if custom["dropped_due_to_rate_limit"] != uint64(3) {
+		t.Errorf("expected 3 dropped reports, got %v", custom["dropped_due_to_rate_limit"])
+	}
+}
+
+func TestRateLimiterIsBoundedByTheLimit(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := newRateLimiter(3)
+	l.allow(now)
+
+	now = now.Add(time.Hour)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.allow(now); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("expected bursts of at most 3 items, got %d", allowed)
+	}
+}
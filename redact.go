@@ -0,0 +1,94 @@
+package rollrus
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rollbar/rollbar-go"
+)
+
+// urlPattern matches URL-looking substrings.
+var urlPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// defaultRedactedParams are the query parameters redacted by
+// WithRedactURLQueryParams when none are given.
+var defaultRedactedParams = []string{"token", "signature", "sig", "key"}
+
+// redactURLQueryParams returns s with the values of the given query parameters
+// replaced in every URL found in it. params must be lower case. URLs that
+// can't be parsed are left unchanged.
+func redactURLQueryParams(s string, params map[string]bool) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		if _, err := url.Parse(raw); err != nil {
+			return raw
+		}
+
+		start := strings.IndexByte(raw, '?')
+		if start < 0 {
+			return raw
+		}
+		end := len(raw)
+		if i := strings.IndexByte(raw[start:], '#'); i >= 0 {
+			end = start + i
+		}
+
+		parts := strings.Split(raw[start+1:end], "&")
+		changed := false
+		for i, p := range parts {
+			k := p
+			if j := strings.IndexByte(p, '='); j >= 0 {
+				k = p[:j]
+			}
+			if key, err := url.QueryUnescape(k); err == nil && params[strings.ToLower(key)] {
+				parts[i] = k + "=" + rollbar.FILTERED
+				changed = true
+			}
+		}
+		if !changed {
+			return raw
+		}
+
+		return raw[:start+1] + strings.Join(parts, "&") + raw[end:]
+	})
+}
+
+// redactStrings redacts all string values of m in place.
+func redactStrings(m map[string]interface{}, params map[string]bool) {
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			m[k] = redactURLQueryParams(s, params)
+		}
+	}
+}
+
+// defaultScrubFields are the request parameters scrubbed by the rollbar client
+// by default, which WithScrubFields adds to.
+var defaultScrubFields = []string{"password", "secret", "token"}
+
+// scrubPattern returns a case-insensitive pattern matching names containing
+// any of the given ones.
+func scrubPattern(names []string) *regexp.Regexp {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = regexp.QuoteMeta(n)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// scrubExtras replaces the values of the keys of m matching re in place.
+// Nested maps may be shared with the caller, like those given to WithCustom,
+// so they are replaced by scrubbed copies instead.
+func scrubExtras(m map[string]interface{}, re *regexp.Regexp) {
+	for k, v := range m {
+		if re.MatchString(k) {
+			m[k] = rollbar.FILTERED
+			continue
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			c := copyExtras(nested)
+			scrubExtras(c, re)
+			m[k] = c
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package rollrus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactURLQueryParams(t *testing.T) {
+	params := map[string]bool{"token": true, "sig": true}
+
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{
+			in:       "GET https://example.com/a/b?Token=secret&page=2&sig=abc#top failed",
+			expected: "GET https://example.com/a/b?Token=[FILTERED]&page=2&sig=[FILTERED]#top failed",
+		},
+		{
+			in:       "no query https://example.com/a/b",
+			expected: "no query https://example.com/a/b",
+		},
+		{
+			in:       "malformed http://exa mple.com/?token=x http://%zz/?token=x",
+			expected: "malformed http://exa mple.com/?token=x http://%zz/?token=x",
+		},
+	}
+
+	for _, c := range cases {
+		if got := redactURLQueryParams(c.in, params); got != c.expected {
+			t.Errorf("got %q, wanted %q", got, c.expected)
+		}
+	}
+}
+
+func TestWithRedactURLQueryParams(t *testing.T) {
+	h := NewHook("", "testing", WithRedactURLQueryParams())
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "fetching https://example.com/?key=secret failed"
+	entry.Data["url"] = "https://example.com/?signature=secret"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	if title := data["title"]; title != "fetching https://example.com/?key=[FILTERED] failed" {
+		t.Errorf("expected the title to be redacted, got %v", title)
+	}
+	exception := traceChain(data)[0]["exception"].(map[string]interface{})
+	if exception["message"] != data["title"] {
+		t.Errorf("expected the exception message to be redacted, got %v", exception["message"])
+	}
+	custom := data["custom"].(map[string]interface{})
+	if custom["url"] != "https://example.com/?signature=[FILTERED]" {
+		t.Errorf("expected the url extra to be redacted, got %v", custom["url"])
+	}
+	if custom["msg"] != data["title"] {
+		t.Errorf("expected the msg extra to be redacted, got %v", custom["msg"])
+	}
+}
+
+func TestWithScrubFieldsAndHeaders(t *testing.T) {
+	h := NewHook("", "testing", WithScrubFields("api_key"), WithScrubHeaders("X-Signature"))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/?API_KEY=secret&page=2", nil)
+	req.Header.Set("X-Signature", "secret")
+	req.Header.Set("Cookie", "session=secret")
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["db_password"] = "hunter2"
+	entry.Data["Api_Key"] = "secret"
+	entry.Data["user"] = "bob"
+	entry.Data[requestField] = req
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	custom := data["custom"].(map[string]interface{})
+	for _, k := range []string{"db_password", "Api_Key"} {
+		if custom[k] != rollbar.FILTERED {
+			t.Errorf("expected %s to be scrubbed, got %v", k, custom[k])
+		}
+	}
+	if custom["user"] != "bob" {
+		t.Errorf("expected other fields to be kept, got %v", custom["user"])
+	}
+
+	request := data["request"].(map[string]interface{})
+	headers := request["headers"].(map[string]interface{})
+	for _, k := range []string{"X-Signature", "Cookie"} {
+		if headers[k] != rollbar.FILTERED {
+			t.Errorf("expected header %s to be scrubbed, got %v", k, headers[k])
+		}
+	}
+	if query := request["query_string"]; strings.Contains(query.(string), "secret") {
+		t.Errorf("expected the api_key parameter to be scrubbed, got %v", query)
+	}
+}
+
+func TestScrubExtrasNested(t *testing.T) {
+	m := map[string]interface{}{
+		"nested": map[string]interface{}{"token": "secret", "id": 1},
+	}
+	scrubExtras(m, scrubPattern(defaultScrubFields))
+	if nested := m["nested"].(map[string]interface{}); nested["token"] != rollbar.FILTERED || nested["id"] != 1 {
+		t.Errorf("expected nested fields to be scrubbed, got %v", nested)
+	}
+}
+
+func TestWithScrubFieldsKeepsCustomData(t *testing.T) {
+	db := map[string]interface{}{"password": "hunter2", "host": "db.example.com"}
+	h := NewHook("", "testing", WithCustom(map[string]interface{}{"db": db}), WithScrubFields())
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry := logrus.NewEntry(nil)
+			entry.Level = logrus.ErrorLevel
+			entry.Message = "This is a test"
+			if err := h.Fire(entry); err != nil {
+				t.Error("unexpected error ", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if db["password"] != "hunter2" {
+		t.Errorf("expected the custom data of the caller to be left alone, got %v", db)
+	}
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if len(ft.sent) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(ft.sent))
+	}
+	custom := ft.sent[0]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if reported := custom["db"].(map[string]interface{}); reported["password"] != rollbar.FILTERED {
+		t.Errorf("expected the password to be scrubbed, got %v", reported)
+	}
+}
@@ -2,6 +2,9 @@ package rollrus
 
 import (
 	"fmt"
+	"os"
+	"regexp"
+	"sync"
 
 	"github.com/rollbar/rollbar-go"
 	"github.com/sirupsen/logrus"
@@ -19,6 +22,56 @@ var wellKnownErrorFields = []string{
 	logrus.ErrorKey, "err",
 }
 
+// levelSeverities maps logrus levels to Rollbar severities.
+var levelSeverities = map[logrus.Level]string{
+	logrus.PanicLevel: rollbar.CRIT,
+	logrus.FatalLevel: rollbar.CRIT,
+	logrus.ErrorLevel: rollbar.ERR,
+	logrus.WarnLevel:  rollbar.WARN,
+	logrus.InfoLevel:  rollbar.INFO,
+	logrus.DebugLevel: rollbar.DEBUG,
+	logrus.TraceLevel: rollbar.DEBUG,
+}
+
+// levelField is the name of the field that can be set to "critical" to report
+// a single entry with the CRIT severity regardless of its level.
+const levelField = "rollbar_level"
+
+// severityField is the name of the field that can be set to any Rollbar
+// severity, like "warning", to report a single entry with that severity
+// regardless of its level. Values that aren't a known severity are ignored.
+const severityField = "rollbar_severity"
+
+// validSeverities are the severities accepted in the severityField.
+var validSeverities = map[string]bool{
+	rollbar.DEBUG: true,
+	rollbar.INFO:  true,
+	rollbar.WARN:  true,
+	rollbar.ERR:   true,
+	rollbar.CRIT:  true,
+}
+
+// tagsField is the name of the field that can be used to attach additional
+// Rollbar tags to a single entry.
+const tagsField = "rollbar_tags"
+
+// uuidField is the name of the field that can be used to provide the UUID of
+// the Rollbar occurrence, for example to correlate it with a trace ID.
+const uuidField = "rollbar_uuid"
+
+// envField is the name of the field that can be used to report a single entry
+// under a different Rollbar environment than the one of the hook, for example
+// the one of the tenant a job was run for. Empty values are ignored.
+const envField = "rollbar_env"
+
+// requestField is the name of the field that can hold the *http.Request an
+// entry was logged for, which is then reported as the request of the item.
+const requestField = "rollbar_request"
+
+// defaultScrubHeaders matches the request headers that are never reported,
+// like Authorization and Cookie.
+var defaultScrubHeaders = regexp.MustCompile("Authorization|Cookie")
+
 // NewHook creates a hook that is intended for use with your own logrus.Logger
 // instance. Uses the default report levels defined in wellKnownErrorFields.
 func NewHook(token string, env string, opts ...OptionFunc) *Hook {
@@ -33,35 +86,232 @@ func NewHook(token string, env string, opts ...OptionFunc) *Hook {
 
 // SetupLogging for use on Heroku. If token is not an empty string a Rollbar
 // hook is added with the environment set to env. The log formatter is set to a
-// TextFormatter with timestamps disabled.
-func SetupLogging(token, env string) {
-	setupLogging(token, env, defaultTriggerLevels)
+// TextFormatter with timestamps disabled. Calling it again replaces the hook
+// added by the previous call. The hook is returned so that it can be closed
+// before exiting, or nil if token is empty.
+func SetupLogging(token, env string) *Hook {
+	return setupLogging(token, env, defaultTriggerLevels, herokuFormatter())
 }
 
 // SetupLoggingForLevels works like SetupLogging, but allows you to
 // set the levels on which to trigger this hook.
-func SetupLoggingForLevels(token, env string, levels []logrus.Level) {
-	setupLogging(token, env, levels)
+func SetupLoggingForLevels(token, env string, levels []logrus.Level) *Hook {
+	return setupLogging(token, env, levels, herokuFormatter())
+}
+
+// SetupLoggingWithTimestamps works like SetupLogging, but keeps timestamps in
+// the log output, for use outside of Heroku. They are formatted according to
+// timestampFormat, or the logrus default if it is empty.
+func SetupLoggingWithTimestamps(token, env, timestampFormat string) *Hook {
+	return setupLogging(token, env, defaultTriggerLevels, &logrus.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: timestampFormat,
+	})
+}
+
+// SetupLoggingWithOptions works like SetupLogging, but configures the hook
+// with the given OptionFuncs, like NewHook.
+func SetupLoggingWithOptions(token, env string, opts ...OptionFunc) *Hook {
+	return setupLogging(token, env, defaultTriggerLevels, herokuFormatter(), opts...)
+}
+
+// SetupLoggingWithFormatter works like SetupLoggingWithOptions, but sets the
+// formatter of the logrus singleton logger to formatter instead. A nil
+// formatter leaves the current one, such as a logrus.JSONFormatter, in place.
+func SetupLoggingWithFormatter(token, env string, formatter logrus.Formatter, opts ...OptionFunc) *Hook {
+	return setupLogging(token, env, defaultTriggerLevels, formatter, opts...)
+}
+
+// herokuFormatter returns the formatter used by SetupLogging. Heroku adds
+// timestamps to the logs itself, so they are disabled.
+func herokuFormatter() logrus.Formatter {
+	return &logrus.TextFormatter{DisableTimestamp: true}
 }
 
-func setupLogging(token, env string, levels []logrus.Level) {
-	logrus.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+// loggingHook is the hook added to the logrus singleton logger by
+// SetupLogging, if any.
+var (
+	loggingMu   sync.Mutex
+	loggingHook *Hook
+)
 
+func setupLogging(token, env string, levels []logrus.Level, formatter logrus.Formatter, opts ...OptionFunc) *Hook {
+	var h *Hook
 	if token != "" {
-		logrus.AddHook(NewHookForLevels(token, env, levels))
+		h = NewHookForLevels(token, env, levels)
+		for _, o := range opts {
+			o(h)
+		}
+	}
+	registerLogging(h, formatter)
+	return h
+}
+
+// registerLogging sets the formatter of the logrus singleton logger, if not
+// nil, and replaces the hook added by a previous call with h, if not nil.
+func registerLogging(h *Hook, formatter logrus.Formatter) {
+	if formatter != nil {
+		logrus.SetFormatter(formatter)
+	}
+
+	loggingMu.Lock()
+	defer loggingMu.Unlock()
+
+	removeHook(logrus.StandardLogger(), loggingHook)
+	loggingHook = h
+	if h != nil {
+		logrus.AddHook(h)
+	}
+}
+
+// SetupLoggingFromEnvironment works like SetupLoggingWithOptions, but reads
+// the configuration from the environment variables ROLLBAR_TOKEN, ROLLBAR_ENV,
+// ROLLBAR_CODE_VERSION, ROLLBAR_ENDPOINT, ROLLBAR_PLATFORM,
+// ROLLBAR_SERVER_HOST and ROLLBAR_SERVER_ROOT, of which only the first two are
+// required. The opts are applied after them. The hook is checked with
+// Validate and only added if it is valid. Without ROLLBAR_TOKEN nothing is
+// done and nil is returned, so that Rollbar can be left unconfigured during
+// development.
+func SetupLoggingFromEnvironment(opts ...OptionFunc) (*Hook, error) {
+	token := os.Getenv("ROLLBAR_TOKEN")
+	if token == "" {
+		return nil, nil
+	}
+
+	var envOpts []OptionFunc
+	for name, opt := range map[string]func(string) OptionFunc{
+		"ROLLBAR_CODE_VERSION": WithCodeVersion,
+		"ROLLBAR_ENDPOINT":     WithEndpoint,
+		"ROLLBAR_PLATFORM":     WithPlatform,
+		"ROLLBAR_SERVER_HOST":  WithServerHost,
+		"ROLLBAR_SERVER_ROOT":  WithServerRoot,
+	} {
+		if v := os.Getenv(name); v != "" {
+			envOpts = append(envOpts, opt(v))
+		}
+	}
+
+	h := NewHook(token, os.Getenv("ROLLBAR_ENV"), append(envOpts, opts...)...)
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	registerLogging(h, herokuFormatter())
+	return h, nil
+}
+
+// RemoveLogging removes the hook added by SetupLogging or
+// SetupLoggingForLevels from the logrus singleton logger. The formatter is
+// left unchanged.
+func RemoveLogging() {
+	loggingMu.Lock()
+	defer loggingMu.Unlock()
+
+	removeHook(logrus.StandardLogger(), loggingHook)
+	loggingHook = nil
+}
+
+// removeHook removes h from all levels of the logger.
+func removeHook(l *logrus.Logger, h *Hook) {
+	if h == nil {
+		return
+	}
+
+	hooks := make(logrus.LevelHooks, len(l.Hooks))
+	for level, hs := range l.Hooks {
+		for _, hook := range hs {
+			if hook != logrus.Hook(h) {
+				hooks[level] = append(hooks[level], hook)
+			}
+		}
 	}
+	l.ReplaceHooks(hooks)
 }
 
 // ReportPanic attempts to report the panic to Rollbar using the provided
 // client and then re-panic. If it can't report the panic it will print an
-// error to stderr.
+// error to stderr. The reported stack trace starts at the function that
+// panicked.
 func ReportPanic(token, env string) {
 	if token != "" {
 		if p := recover(); p != nil {
 			defer panic(p)
 			r := rollbar.New(token, env, "", "", "")
-			r.ErrorWithLevel(rollbar.CRIT, fmt.Errorf("panic: %q", p))
+			// the rollbar client needs 3 frames to be skipped to get to us.
+			r.ErrorWithStackSkip(rollbar.CRIT, panicError(defaultPanicPrefix, p), panicSiteSkip()+3)
 			r.Wait()
 		}
 	}
 }
+
+// ReportPanic works like the package's ReportPanic, but reports the panic
+// through the hook's client. It must be deferred directly. Like Close it does
+// nothing for a nil hook, so the panic goes on unreported.
+func (r *Hook) ReportPanic() {
+	if r == nil {
+		return
+	}
+	if p := recover(); p != nil {
+		defer panic(p)
+		r.reportPanic(defaultPanicPrefix, p, panicSiteSkip())
+	}
+}
+
+// ReportPanicWithPrefix works like ReportPanic, but reports the panic through
+// the hook's client with prefix instead of "panic:" in front of the panic
+// value, for example "worker panic:". It must be deferred directly.
+func (r *Hook) ReportPanicWithPrefix(prefix string) {
+	if r == nil {
+		return
+	}
+	if p := recover(); p != nil {
+		defer panic(p)
+		r.reportPanic(prefix, p, panicSiteSkip())
+	}
+}
+
+// reportPanic reports the recovered panic value p. skip is the number of
+// frames from the deferred function calling it to the function that panicked.
+func (r *Hook) reportPanic(prefix string, p interface{}, skip int) {
+	if r.Client == nil {
+		r.warnNilClient()
+		return
+	}
+	if r.muted() {
+		r.countSuppressed()
+		return
+	}
+	r.clientLock().RLock()
+	defer r.clientLock().RUnlock()
+	err := panicError(prefix, p)
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.PanicLevel
+	entry.Message = err.Error()
+	o := r.newOccurrence(entry)
+	m := make(map[string]interface{})
+	if r.dryRun != nil {
+		r.writeDryRun(entry, rollbar.CRIT, err, o, m)
+		return
+	}
+	if r.panicStackDepth > 0 {
+		if o.stack = rollbar.BuildStack(skip + 2); len(o.stack) > r.panicStackDepth {
+			o.stack = o.stack[:r.panicStackDepth]
+		}
+	}
+	r.attachOccurrence(r.Client, m, o)
+	// the rollbar client needs 2 frames to be skipped to get to us, and one
+	// more to get out of reportPanic.
+	r.Client.ErrorWithStackSkipWithExtras(rollbar.CRIT, err, skip+3, m)
+	r.Client.Wait()
+}
+
+// defaultPanicPrefix is put in front of panic values reported by ReportPanic.
+const defaultPanicPrefix = "panic:"
+
+// panicError converts a recovered panic value into the error to report. Errors
+// are wrapped so that they can still be unwrapped, other values are quoted.
+func panicError(prefix string, p interface{}) error {
+	if err, ok := p.(error); ok {
+		return fmt.Errorf("%s %w", prefix, err)
+	}
+	return fmt.Errorf("%s %q", prefix, p)
+}
@@ -0,0 +1,273 @@
+package rollrus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func countRollrusHooks(level logrus.Level) int {
+	n := 0
+	for _, h := range logrus.StandardLogger().Hooks[level] {
+		if _, ok := h.(*Hook); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSetupLoggingReplacesHook(t *testing.T) {
+	defer RemoveLogging()
+
+	first := SetupLogging("some-token", "testing")
+	second := SetupLogging("some-token", "testing")
+	if first == nil || second == nil || first == second {
+		t.Fatalf("expected a new hook to be returned by each call, got %p and %p", first, second)
+	}
+
+	if n := countRollrusHooks(logrus.ErrorLevel); n != 1 {
+		t.Fatalf("expected 1 hook after setting up logging twice, got %d", n)
+	}
+
+	RemoveLogging()
+	if n := countRollrusHooks(logrus.ErrorLevel); n != 0 {
+		t.Fatalf("expected no hook after removing logging, got %d", n)
+	}
+}
+
+func TestSetupLoggingWithOptions(t *testing.T) {
+	defer RemoveLogging()
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+
+	SetupLoggingWithOptions("some-token", "testing", WithIgnoredErrors(io.EOF), WithLevels(logrus.WarnLevel))
+
+	if n := countRollrusHooks(logrus.WarnLevel); n != 1 {
+		t.Fatalf("expected the hook to be added for the configured levels, got %d", n)
+	}
+	if n := countRollrusHooks(logrus.ErrorLevel); n != 0 {
+		t.Fatalf("expected no hook for other levels, got %d", n)
+	}
+	if len(loggingHook.ignoredErrors) != 1 || loggingHook.ignoredErrors[0] != io.EOF {
+		t.Errorf("expected the options to be applied, got %v", loggingHook.ignoredErrors)
+	}
+}
+
+func TestSetupLoggingFromEnvironment(t *testing.T) {
+	defer RemoveLogging()
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+
+	for k, v := range map[string]string{
+		"ROLLBAR_TOKEN":        "some-token",
+		"ROLLBAR_ENV":          "staging",
+		"ROLLBAR_CODE_VERSION": "abc123",
+		"ROLLBAR_ENDPOINT":     "https://rollbar-relay.internal/api/1/item/",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	h, err := SetupLoggingFromEnvironment(WithLevels(logrus.WarnLevel))
+	if err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	env, version, endpoint := h.Client.Environment(), h.Client.CodeVersion(), h.Client.Endpoint()
+	if env != "staging" || version != "abc123" || endpoint != "https://rollbar-relay.internal/api/1/item/" {
+		t.Errorf("expected the configuration from the environment, got %q, %q and %q", env, version, endpoint)
+	}
+	if n := countRollrusHooks(logrus.WarnLevel); n != 1 {
+		t.Fatalf("expected the hook to be added, got %d", n)
+	}
+
+	os.Setenv("ROLLBAR_ENDPOINT", "not a url")
+	if _, err := SetupLoggingFromEnvironment(); err == nil {
+		t.Error("expected an invalid endpoint to be rejected")
+	}
+	if loggingHook != h {
+		t.Error("expected an invalid configuration to keep the previous hook")
+	}
+
+	os.Unsetenv("ROLLBAR_TOKEN")
+	if h, err := SetupLoggingFromEnvironment(); h != nil || err != nil {
+		t.Errorf("expected nothing to happen without a token, got %v and %v", h, err)
+	}
+	if loggingHook == nil {
+		t.Error("expected the previous hook to be kept without a token")
+	}
+}
+
+func TestSetupLoggingWithFormatter(t *testing.T) {
+	defer RemoveLogging()
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+
+	json := &logrus.JSONFormatter{}
+	logrus.SetFormatter(json)
+	if h := SetupLoggingWithFormatter("some-token", "testing", nil); h == nil {
+		t.Fatal("expected a hook to be returned")
+	}
+	if logrus.StandardLogger().Formatter != json {
+		t.Errorf("expected the formatter to be kept, got %#v", logrus.StandardLogger().Formatter)
+	}
+
+	text := &logrus.TextFormatter{}
+	SetupLoggingWithFormatter("some-token", "testing", text)
+	if logrus.StandardLogger().Formatter != text {
+		t.Errorf("expected the given formatter, got %#v", logrus.StandardLogger().Formatter)
+	}
+	if n := countRollrusHooks(logrus.ErrorLevel); n != 1 {
+		t.Fatalf("expected 1 hook, got %d", n)
+	}
+}
+
+func TestPanicError(t *testing.T) {
+	err := panicError(defaultPanicPrefix, io.EOF)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the panic error to wrap io.EOF, got %#v", err)
+	}
+	if err.Error() != "panic: EOF" {
+		t.Fatalf("got %q, wanted %q", err.Error(), "panic: EOF")
+	}
+
+	err = panicError(defaultPanicPrefix, "boom")
+	if err.Error() != `panic: "boom"` {
+		t.Fatalf("got %q, wanted %q", err.Error(), `panic: "boom"`)
+	}
+}
+
+func TestReportPanicWithPrefix(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("expected the panic to be re-raised, got %v", p)
+			}
+		}()
+		defer h.ReportPanicWithPrefix("worker panic:")
+		panic("boom")
+	}()
+
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(ft.sent))
+	}
+	data := ft.sent[0]["data"].(map[string]interface{})
+	if data["level"] != "critical" {
+		t.Errorf("got level %v, wanted critical", data["level"])
+	}
+	exception := traceChain(data)[0]["exception"].(map[string]interface{})
+	if want := `worker panic: "boom"`; exception["message"] != want {
+		t.Errorf("got message %v, wanted %q", exception["message"], want)
+	}
+	if _, exists := data["custom"]; exists {
+		t.Errorf("expected no custom data, got %v", data["custom"])
+	}
+}
+
+func panicking() {
+	panic("boom")
+}
+
+func reportedPanicFrames(t *testing.T, h *Hook) rollbar.Stack {
+	t.Helper()
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	func() {
+		defer func() { _ = recover() }()
+		defer h.ReportPanicWithPrefix("panic:")
+		panicking()
+	}()
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	return traceChain(data)[0]["frames"].(rollbar.Stack)
+}
+
+func TestReportPanicStackStartsAtPanic(t *testing.T) {
+	frames := reportedPanicFrames(t, NewHook("", "testing"))
+	if len(frames) < 2 || frames[0].Method != "rollrus.panicking" {
+		t.Fatalf("expected the stack to start at the panic, got %v", frames)
+	}
+}
+
+func TestHookReportPanic(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	func() {
+		defer func() { _ = recover() }()
+		defer h.ReportPanic()
+		panicking()
+	}()
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	chain := traceChain(data)
+	if frames := chain[0]["frames"].(rollbar.Stack); len(frames) < 2 || frames[0].Method != "rollrus.panicking" {
+		t.Fatalf("expected the stack to start at the panic, got %v", frames)
+	}
+	exception := chain[0]["exception"].(map[string]interface{})
+	if want := `panic: "boom"`; exception["message"] != want {
+		t.Errorf("got message %v, wanted %q", exception["message"], want)
+	}
+}
+
+func TestHookReportPanicIsGated(t *testing.T) {
+	var buf bytes.Buffer
+	cases := []struct {
+		name string
+		hook *Hook
+	}{
+		{name: "disabled", hook: NewHook("", "testing")},
+		{name: "environment", hook: NewHook("", "development", WithEnabledEnvironments("production"))},
+		{name: "dry run", hook: NewHook("", "testing", WithDryRun(&buf))},
+	}
+	cases[0].hook.Disable()
+
+	for _, c := range cases {
+		ft := withFakeTransport(c.hook, &fakeTransport{})
+		func() {
+			defer func() { _ = recover() }()
+			defer c.hook.ReportPanic()
+			panicking()
+		}()
+		if len(ft.sent) != 0 {
+			t.Errorf("%s: expected the panic not to be sent, got %d sent", c.name, len(ft.sent))
+		}
+	}
+	if s := cases[0].hook.Stats(); s.Suppressed != 1 {
+		t.Errorf("expected the panic to be counted as suppressed, got %+v", s)
+	}
+	if !strings.Contains(buf.String(), `panic: \"boom\"`) {
+		t.Errorf("expected the panic to be written to the dry run writer, got %q", buf.String())
+	}
+}
+
+func TestWithPanicStackDepth(t *testing.T) {
+	frames := reportedPanicFrames(t, NewHook("", "testing", WithPanicStackDepth(1)))
+	if len(frames) != 1 || frames[0].Method != "rollrus.panicking" {
+		t.Fatalf("expected only the panicking frame, got %v", frames)
+	}
+}
+
+func TestSetupLoggingWithTimestamps(t *testing.T) {
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+
+	SetupLoggingWithTimestamps("", "testing", time.RFC3339)
+	f, ok := logrus.StandardLogger().Formatter.(*logrus.TextFormatter)
+	if !ok || f.DisableTimestamp || !f.FullTimestamp || f.TimestampFormat != time.RFC3339 {
+		t.Fatalf("expected a text formatter with timestamps, got %#v", logrus.StandardLogger().Formatter)
+	}
+
+	if h := SetupLogging("", "testing"); h != nil {
+		t.Fatalf("expected no hook without a token, got %v", h)
+	}
+	f, ok = logrus.StandardLogger().Formatter.(*logrus.TextFormatter)
+	if !ok || !f.DisableTimestamp {
+		t.Fatalf("expected SetupLogging to disable timestamps, got %#v", logrus.StandardLogger().Formatter)
+	}
+}
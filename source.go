@@ -0,0 +1,108 @@
+package rollrus
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rollbar/rollbar-go"
+)
+
+// maxContextFrames is the number of innermost frames of a trace that source
+// context is added to.
+const maxContextFrames = 10
+
+// sourceContext reads the source lines around frames from files below root,
+// see WithSourceContext.
+type sourceContext struct {
+	root  string
+	lines int
+
+	mu    sync.Mutex
+	files map[string][]string // nil for files that couldn't be read
+}
+
+func newSourceContext(root string, lines int) *sourceContext {
+	return &sourceContext{root: root, lines: lines, files: make(map[string][]string)}
+}
+
+// frames returns the frames of a trace with the source context added to the
+// innermost ones whose files can be found.
+func (c *sourceContext) frames(s rollbar.Stack) []map[string]interface{} {
+	frames := make([]map[string]interface{}, len(s))
+	for i, f := range s {
+		frame := map[string]interface{}{
+			"filename": f.Filename,
+			"method":   f.Method,
+			"lineno":   f.Line,
+		}
+		if i < maxContextFrames {
+			c.addContext(frame, f)
+		}
+		frames[i] = frame
+	}
+	return frames
+}
+
+// addContext adds the code of the line of f and the lines around it to frame.
+func (c *sourceContext) addContext(frame map[string]interface{}, f rollbar.Frame) {
+	src := c.file(f.Filename)
+	if f.Line < 1 || f.Line > len(src) {
+		return
+	}
+	i := f.Line - 1
+	pre := i - c.lines
+	if pre < 0 {
+		pre = 0
+	}
+	post := i + 1 + c.lines
+	if post > len(src) {
+		post = len(src)
+	}
+
+	frame["code"] = src[i]
+	frame["context"] = map[string]interface{}{
+		"pre":  src[pre:i],
+		"post": src[i+1 : post],
+	}
+}
+
+// file returns the lines of the file, which is looked up below root with as
+// few leading directories of name removed as needed, like github.com/user.
+func (c *sourceContext) file(name string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if src, ok := c.files[name]; ok {
+		return src
+	}
+
+	var src []string
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for i := range parts {
+		if lines, err := readLines(filepath.Join(c.root, filepath.Join(parts[i:]...))); err == nil {
+			src = lines
+			break
+		}
+	}
+	c.files[name] = src
+	return src
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines, s.Err()
+}
@@ -0,0 +1,186 @@
+package rollrus
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rollbar/rollbar-go"
+)
+
+// knownFilePathPatterns mirror the ones used by rollbar-go to shorten file
+// paths.
+var knownFilePathPatterns = []string{
+	"github.com/",
+	"code.google.com/",
+	"bitbucket.org/",
+	"launchpad.net/",
+}
+
+// errorStack returns the stack carried by err, using the configured stack
+// extractor, or nil if it doesn't carry one. Errors implementing
+// rollbar.CauseStacker are left to the rollbar client.
+func (r *Hook) errorStack(err error) rollbar.Stack {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(rollbar.CauseStacker); ok {
+		return nil
+	}
+
+	extract := r.stackExtractor
+	if extract == nil {
+		extract = pkgErrorsStack
+	}
+
+	frames := extract(err)
+	if len(frames) == 0 {
+		return nil
+	}
+	return rollbarStack(frames)
+}
+
+// pkgErrorsStack returns the stack recorded by the innermost error in the
+// chain that provides a github.com/pkg/errors StackTrace.
+func pkgErrorsStack(err error) []runtime.Frame {
+	type stackTracer interface {
+		StackTrace() errors.StackTrace
+	}
+	type causer interface {
+		Cause() error
+	}
+
+	var st errors.StackTrace
+	for err != nil {
+		if s, ok := err.(stackTracer); ok {
+			st = s.StackTrace()
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	if len(st) == 0 {
+		return nil
+	}
+
+	pcs := make([]uintptr, len(st))
+	for i, f := range st {
+		pcs[i] = uintptr(f)
+	}
+
+	frames := make([]runtime.Frame, 0, len(pcs))
+	it := runtime.CallersFrames(pcs)
+	for {
+		f, more := it.Next()
+		frames = append(frames, f)
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// rollbarStack converts frames into a rollbar.Stack, formatting them the same
+// way rollbar.BuildStack does.
+func rollbarStack(frames []runtime.Frame) rollbar.Stack {
+	stack := make(rollbar.Stack, 0, len(frames))
+	for _, f := range frames {
+		method := f.Function
+		if method == "" {
+			method = "???"
+		}
+		method = method[strings.LastIndex(method, "/")+1:]
+		stack = append(stack, rollbar.Frame{Filename: shortenFilePath(f.File), Method: method, Line: f.Line})
+	}
+	return stack
+}
+
+// shortenFilePath removes the machine specific part of a source file path.
+func shortenFilePath(s string) string {
+	if idx := strings.Index(s, "/src/pkg/"); idx != -1 {
+		return s[idx+5:]
+	}
+	for _, pattern := range knownFilePathPatterns {
+		if idx := strings.Index(s, pattern); idx != -1 {
+			return s[idx:]
+		}
+	}
+	return s
+}
+
+// callerFunction returns the name of the function that logged the entry,
+// found by walking the stack the same way framesToSkip does.
+func callerFunction(rollrusSkip int) string {
+	// framesToSkip is relative to the rollbar client, two frames deeper than
+	// this function once our own frame is accounted for.
+	pc, _, _, ok := callerFunc(framesToSkip(rollrusSkip+1) - 2)
+	if !ok {
+		return ""
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
+
+// goroutineID returns the ID of the current goroutine as printed in its stack
+// trace, or 0 if it can't be determined.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, err := strconv.ParseUint(string(buf), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// panicSiteSkip returns how many frames to skip, starting at the function
+// calling it, to get to the function that panicked. The caller must be a
+// deferred function that recovered the panic, otherwise 0 is returned.
+func panicSiteSkip() int {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	panicking := false
+	for i := 0; ; i++ {
+		f, more := frames.Next()
+		if panicking && !strings.HasPrefix(f.Function, "runtime.") {
+			return i
+		}
+		if f.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			return 0
+		}
+	}
+}
+
+// collapseRecursiveFrames replaces runs of identical consecutive frames with
+// their first frame, noting how often it was repeated in the method name.
+func collapseRecursiveFrames(s rollbar.Stack) rollbar.Stack {
+	collapsed := make(rollbar.Stack, 0, len(s))
+	for i := 0; i < len(s); {
+		j := i + 1
+		for j < len(s) && s[j] == s[i] {
+			j++
+		}
+		f := s[i]
+		if n := j - i; n > 1 {
+			f.Method += " (repeated " + strconv.Itoa(n) + " times)"
+		}
+		collapsed = append(collapsed, f)
+		i = j
+	}
+	return collapsed
+}
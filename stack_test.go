@@ -0,0 +1,247 @@
+package rollrus
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func newStackError() error {
+	return errors.Wrap(errors.New("boom"), "wrapped")
+}
+
+func reportedFrames(t *testing.T, h *Hook, err error) rollbar.Stack {
+	t.Helper()
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	entry.Data["err"] = err
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	trace := data["body"].(map[string]interface{})["trace_chain"].([]map[string]interface{})[0]
+	return trace["frames"].(rollbar.Stack)
+}
+
+func TestPkgErrorsStackIsReported(t *testing.T) {
+	frames := reportedFrames(t, NewHook("", "testing"), newStackError())
+	if len(frames) == 0 || frames[0].Method != "rollrus.newStackError" {
+		t.Fatalf("expected the stack of the error, got %v", frames)
+	}
+	if !strings.HasSuffix(frames[0].Filename, "stack_test.go") {
+		t.Fatalf("expected the file of the error, got %v", frames[0])
+	}
+}
+
+func TestWithStackExtractor(t *testing.T) {
+	h := NewHook("", "testing", WithStackExtractor(func(err error) []runtime.Frame {
+		return []runtime.Frame{{Function: "example.com/app.handler", File: "/go/src/github.com/app/handler.go", Line: 42}}
+	}))
+
+	frames := reportedFrames(t, h, io.EOF)
+	expected := rollbar.Stack{{Filename: "github.com/app/handler.go", Method: "app.handler", Line: 42}}
+	if len(frames) != 1 || frames[0] != expected[0] {
+		t.Fatalf("expected %v, got %v", expected, frames)
+	}
+}
+
+func TestWithCallerInfo(t *testing.T) {
+	h := NewHook("", "testing", WithCallerInfo())
+	ft := withFakeTransport(h, &fakeTransport{})
+	l := logrus.New()
+	l.AddHook(h)
+
+	l.Error("This is a test")
+
+	got := ft.sent[0]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if got["caller"] != "github.com/heroku/rollrus.TestWithCallerInfo" {
+		t.Errorf("expected the caller to be the test function, got %v", got["caller"])
+	}
+	if id, ok := got["goroutine"].(uint64); !ok || id == 0 {
+		t.Errorf("expected a goroutine ID, got %v", got["goroutine"])
+	}
+}
+
+func TestWithoutStackTraceForWarnings(t *testing.T) {
+	h := NewHook("", "testing", WithMinLevel(logrus.WarnLevel), WithoutStackTraceForWarnings())
+	ft := withFakeTransport(h, &fakeTransport{})
+	l := logrus.New()
+	l.AddHook(h)
+
+	l.WithError(io.EOF).Warn("This is a test")
+	l.WithError(io.EOF).Error("This is a test")
+
+	warning := ft.sent[0]["data"].(map[string]interface{})["body"].(map[string]interface{})
+	if _, exists := warning["trace_chain"]; exists {
+		t.Errorf("expected the warning to have no stack trace, got %v", warning)
+	}
+	if warning["message"].(map[string]interface{})["body"] != "EOF" {
+		t.Errorf("expected the warning to carry the error message, got %v", warning)
+	}
+
+	failure := ft.sent[1]["data"].(map[string]interface{})["body"].(map[string]interface{})
+	if _, exists := failure["trace_chain"]; !exists {
+		t.Errorf("expected the error to have a stack trace, got %v", failure)
+	}
+}
+
+func recursiveStackError(depth int) error {
+	if depth == 0 {
+		return errors.New("too deep")
+	}
+	return recursiveStackError(depth - 1)
+}
+
+func TestWithCollapseRecursiveFrames(t *testing.T) {
+	frames := reportedFrames(t, NewHook("", "testing", WithCollapseRecursiveFrames()), recursiveStackError(5))
+	if len(frames) < 3 {
+		t.Fatalf("expected at least 3 frames, got %v", frames)
+	}
+	if frames[0].Method != "rollrus.recursiveStackError" {
+		t.Errorf("expected the innermost frame first, got %v", frames[0])
+	}
+	if frames[1].Method != "rollrus.recursiveStackError (repeated 5 times)" {
+		t.Errorf("expected the recursive frames to be collapsed, got %v", frames[1])
+	}
+	if frames[2].Method == frames[1].Method {
+		t.Errorf("expected a single collapsed frame, got %v", frames)
+	}
+}
+
+func TestCollapseRecursiveFrames(t *testing.T) {
+	a := rollbar.Frame{Filename: "a.go", Method: "a", Line: 1}
+	b := rollbar.Frame{Filename: "b.go", Method: "b", Line: 2}
+	got := collapseRecursiveFrames(rollbar.Stack{a, b, b, b, a, a})
+	expected := rollbar.Stack{
+		a,
+		{Filename: "b.go", Method: "b (repeated 3 times)", Line: 2},
+		{Filename: "a.go", Method: "a (repeated 2 times)", Line: 1},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
+
+func TestWithSourceContext(t *testing.T) {
+	h := NewHook("", "testing", WithSourceContext(".", 1))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Data["err"] = newStackError()
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	frames := traceChain(data)[0]["frames"].([]map[string]interface{})
+	src, err := readLines("stack_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := frames[0]["lineno"].(int)
+	if frames[0]["method"] != "rollrus.newStackError" || frames[0]["code"] != src[line-1] {
+		t.Fatalf("expected the code of the innermost frame, got %v", frames[0])
+	}
+	context := frames[0]["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["pre"], src[line-2:line-1]) || !reflect.DeepEqual(context["post"], src[line:line+1]) {
+		t.Errorf("expected one line of context around the frame, got %v", context)
+	}
+
+	for _, f := range frames {
+		if strings.HasPrefix(f["filename"].(string), "runtime/") {
+			if _, exists := f["code"]; exists {
+				t.Errorf("expected no context for files outside of the root, got %v", f)
+			}
+		}
+	}
+}
+
+func TestWithSourceContextRejectsNegativeLines(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("", "testing", WithDiagnosticWriter(&buf), WithSourceContext(".", -1))
+	if h.source != nil {
+		t.Fatal("expected negative lines to be rejected")
+	}
+	if !strings.Contains(buf.String(), "WithSourceContext needs a non-negative number of lines") {
+		t.Errorf("expected a warning, got %q", buf.String())
+	}
+
+	ft := withFakeTransport(h, &fakeTransport{})
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Data["err"] = newStackError()
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected the error to be reported, got %d sent", len(ft.sent))
+	}
+}
+
+func TestStackStartsAtTheLoggingCall(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+
+	l.Error("This is a test")
+
+	frames := traceChain(ft.sent[0]["data"].(map[string]interface{}))[0]["frames"].(rollbar.Stack)
+	if frames[0].Method != "rollrus.TestStackStartsAtTheLoggingCall" {
+		t.Errorf("expected the stack to start at the test, got %v", frames[0])
+	}
+}
+
+func TestReport(t *testing.T) {
+	var got ReportContext
+	h := NewHook("", "testing", WithCallerInfo())
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	h.Report(logrus.ErrorLevel, io.ErrUnexpectedEOF, map[string]interface{}{"job": "import"})
+
+	data := ft.sent[0]["data"].(map[string]interface{})
+	frames := traceChain(data)[0]["frames"].(rollbar.Stack)
+	if frames[0].Method != "rollrus.TestReport" {
+		t.Errorf("expected the stack to start at the caller of Report, got %v", frames[0])
+	}
+	custom := data["custom"].(map[string]interface{})
+	if custom["job"] != "import" || custom["caller"] != "github.com/heroku/rollrus.TestReport" {
+		t.Errorf("unexpected extras %v", custom)
+	}
+	exception := traceChain(data)[0]["exception"].(map[string]interface{})
+	if exception["message"] != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("got message %v, wanted %q", exception["message"], io.ErrUnexpectedEOF.Error())
+	}
+
+	h = NewHook("", "testing", WithIgnoredErrors(io.EOF), WithIgnoreReportFunc(func(rc ReportContext) bool {
+		got = rc
+		return false
+	}))
+	withFakeTransport(h, &fakeTransport{})
+	h.Report(logrus.ErrorLevel, io.EOF, nil)
+	if h.reported || got.Entry != nil {
+		t.Errorf("expected ignored errors to be dropped by Report too")
+	}
+
+	h = NewHook("", "testing")
+	ft = withFakeTransport(h, &fakeTransport{})
+	h.Report(logrus.DebugLevel, io.ErrUnexpectedEOF, nil)
+	h.Report(logrus.ErrorLevel, nil, nil)
+	if len(ft.sent) != 0 {
+		t.Errorf("expected unhandled levels and nil errors not to be reported, got %d sent", len(ft.sent))
+	}
+}
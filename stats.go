@@ -0,0 +1,100 @@
+package rollrus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HookStats is a snapshot of what a Hook has done so far.
+type HookStats struct {
+	// Reported is the number of items successfully sent to Rollbar, or queued
+	// by an asynchronous client, see WithAsync. Such a client only logs items
+	// it fails to send later on, so they are still counted as reported.
+	Reported uint64
+	// Ignored is the number of entries that were not reported because they
+	// matched one of the ignore options.
+	Ignored uint64
+	// Failed is the number of items that could not be sent to Rollbar, or
+	// queued because the buffer of an asynchronous client was full.
+	Failed uint64
+	// Suppressed is the number of entries that were not reported because the
+	// hook was disabled, see Disable and WithEnabledEnvironments.
+	Suppressed uint64
+	// LastReport is the time of the last report counted as Reported, or the
+	// zero time if there was none yet.
+	LastReport time.Time
+}
+
+// counters backs HookStats. It must be the first field of Hook so that its
+// 64-bit values are aligned for atomic access on 32-bit platforms.
+type counters struct {
+	reported   uint64
+	ignored    uint64
+	failed     uint64
+	suppressed uint64
+	lastReport int64 // unix nanoseconds
+}
+
+// labelCounters counts ignored entries by label, see WithCountedIgnore.
+type labelCounters struct {
+	mu      sync.Mutex
+	ignored map[string]uint64
+}
+
+// Stats returns the current counters of the hook. Only items sent through a
+// client created by rollrus or passed to WithClient are counted.
+func (r *Hook) Stats() HookStats {
+	s := HookStats{
+		Reported:   atomic.LoadUint64(&r.counters.reported),
+		Ignored:    atomic.LoadUint64(&r.counters.ignored),
+		Failed:     atomic.LoadUint64(&r.counters.failed),
+		Suppressed: atomic.LoadUint64(&r.counters.suppressed),
+	}
+	if last := atomic.LoadInt64(&r.counters.lastReport); last != 0 {
+		s.LastReport = time.Unix(0, last)
+	}
+	return s
+}
+
+// IgnoredByLabel returns how many entries WithCountedIgnore ignored per label.
+// They are also counted as ignored in Stats.
+func (r *Hook) IgnoredByLabel() map[string]uint64 {
+	r.labels.mu.Lock()
+	defer r.labels.mu.Unlock()
+
+	counts := make(map[string]uint64, len(r.labels.ignored))
+	for k, v := range r.labels.ignored {
+		counts[k] = v
+	}
+	return counts
+}
+
+func (r *Hook) countIgnored() {
+	atomic.AddUint64(&r.counters.ignored, 1)
+}
+
+func (r *Hook) countSuppressed() {
+	atomic.AddUint64(&r.counters.suppressed, 1)
+}
+
+// countIgnoredLabel counts an entry ignored by WithCountedIgnore.
+func (r *Hook) countIgnoredLabel(label string) {
+	r.countIgnored()
+
+	r.labels.mu.Lock()
+	defer r.labels.mu.Unlock()
+	if r.labels.ignored == nil {
+		r.labels.ignored = make(map[string]uint64)
+	}
+	r.labels.ignored[label]++
+}
+
+func (r *Hook) countSent(err error) {
+	if err != nil {
+		atomic.AddUint64(&r.counters.failed, 1)
+		return
+	}
+	atomic.AddUint64(&r.counters.reported, 1)
+	atomic.StoreInt64(&r.counters.lastReport, r.now().UnixNano())
+}
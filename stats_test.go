@@ -0,0 +1,91 @@
+package rollrus
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2019, 9, 23, 12, 0, 0, 0, time.UTC)
+	h := NewHook("", "testing", WithClock(fixedClock(now)), WithIgnoredErrors(io.EOF))
+	withFakeTransport(h, &fakeTransport{err: rollbar.ErrHTTPError(http.StatusUnauthorized), failures: 1})
+
+	if s := h.Stats(); s != (HookStats{}) {
+		t.Fatalf("expected empty stats, got %+v", s)
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	for _, err := range []error{nil, nil, io.EOF} {
+		entry.Data["err"] = err
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	s := h.Stats()
+	if s.Reported != 1 || s.Ignored != 1 || s.Failed != 1 || !s.LastReport.Equal(now) {
+		t.Fatalf("expected one report, ignore and failure at %s, got %+v", now, s)
+	}
+}
+
+func TestStatsCountQueuedItems(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	h := NewHook("some-token", "testing", WithAsync(0), WithOnError(func(error) {}))
+	h.Client.SetEndpoint(ts.URL)
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	_ = h.Close()
+
+	if s := h.Stats(); s.Reported != 1 || s.Failed != 0 {
+		t.Fatalf("expected the queued item to be counted as reported, got %+v", s)
+	}
+}
+
+func TestWithCountedIgnore(t *testing.T) {
+	h := NewHook("", "testing", WithCountedIgnore(func(err error) (bool, string) {
+		switch err {
+		case io.EOF:
+			return true, "eof"
+		case io.ErrUnexpectedEOF:
+			return true, "unexpected-eof"
+		}
+		return false, ""
+	}))
+	withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	for _, err := range []error{io.EOF, io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe} {
+		entry.Data["err"] = err
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if s := h.Stats(); s.Reported != 1 || s.Ignored != 3 {
+		t.Errorf("expected one report and three ignored entries, got %+v", s)
+	}
+	expected := map[string]uint64{"eof": 2, "unexpected-eof": 1}
+	if got := h.IgnoredByLabel(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
@@ -0,0 +1,97 @@
+package rollrus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxTelemetryEvents is the number of observed entries kept by a hook.
+const maxTelemetryEvents = 100
+
+// eventRing is a bounded, goroutine safe buffer of the most recent events.
+// The zero value is ready to use.
+type eventRing struct {
+	mu     sync.Mutex
+	events []map[string]interface{}
+	next   int
+}
+
+// add an event, replacing the oldest one when the buffer holds max events.
+func (t *eventRing) add(event map[string]interface{}, max int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.events) < max {
+		t.events = append(t.events, event)
+		return
+	}
+	t.events[t.next] = event
+	t.next = (t.next + 1) % max
+}
+
+// snapshot returns the events from oldest to newest, or nil if there are none.
+func (t *eventRing) snapshot() []map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.events) == 0 {
+		return nil
+	}
+	events := make([]map[string]interface{}, 0, len(t.events))
+	events = append(events, t.events[t.next:]...)
+	return append(events, t.events[:t.next]...)
+}
+
+// take returns the events like snapshot and removes them.
+func (t *eventRing) take() []map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.events) == 0 {
+		return nil
+	}
+	events := make([]map[string]interface{}, 0, len(t.events))
+	events = append(events, t.events[t.next:]...)
+	events = append(events, t.events[:t.next]...)
+	t.events, t.next = nil, 0
+	return events
+}
+
+// Observe records the entry as a Rollbar telemetry event without reporting it.
+// The most recent observed entries are sent as the telemetry of every
+// following item.
+//
+// Entries of the levels passed to WithObserveLevels are observed by Fire, so
+// they are recorded in the order they were logged and always before any item
+// reported afterwards, independently of other hooks. Observe is for feeding
+// entries from elsewhere, for example from another logger.
+func (r *Hook) Observe(entry *logrus.Entry) {
+	msg := entry.Message
+	if r.redactParams != nil {
+		msg = redactURLQueryParams(msg, r.redactParams)
+	}
+
+	r.telemetry.add(map[string]interface{}{
+		"level":        levelSeverities[entry.Level],
+		"type":         "log",
+		"source":       "server",
+		"timestamp_ms": r.entryTime(entry).UnixNano() / 1e6,
+		"body":         map[string]interface{}{"message": msg},
+	}, maxTelemetryEvents)
+}
+
+// recordRecentLog adds the entry to the logs reported by WithRecentLogs.
+func (r *Hook) recordRecentLog(entry *logrus.Entry) {
+	msg := entry.Message
+	if r.redactParams != nil {
+		msg = redactURLQueryParams(msg, r.redactParams)
+	}
+
+	r.recentLogs.add(map[string]interface{}{
+		"level":   entry.Level.String(),
+		"message": msg,
+		"time":    r.entryTime(entry).Format(time.RFC3339),
+	}, r.recentLogsSize)
+}
@@ -0,0 +1,110 @@
+package rollrus
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTelemetryFromObservedEntries(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := NewHook("", "testing", WithObserveLevels(logrus.InfoLevel), WithClock(fixedClock(now)))
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	l := logrus.New()
+	l.AddHook(h)
+	l.Info("first")
+	l.Debug("not observed")
+	h.Observe(&logrus.Entry{Level: logrus.WarnLevel, Message: "second"})
+	l.Error("This is a test")
+
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(ft.sent))
+	}
+	body := ft.sent[0]["data"].(map[string]interface{})["body"].(map[string]interface{})
+	events, ok := body["telemetry"].([]map[string]interface{})
+	if !ok || len(events) != 2 {
+		t.Fatalf("expected 2 telemetry events, got %v", body["telemetry"])
+	}
+	if msg := events[0]["body"].(map[string]interface{})["message"]; msg != "first" || events[0]["level"] != "info" {
+		t.Errorf("unexpected first event %v", events[0])
+	}
+	if msg := events[1]["body"].(map[string]interface{})["message"]; msg != "second" || events[1]["level"] != "warning" {
+		t.Errorf("unexpected second event %v", events[1])
+	}
+	if ms := events[1]["timestamp_ms"]; ms != now.UnixNano()/1e6 {
+		t.Errorf("got timestamp %v, wanted the clock's time", ms)
+	}
+}
+
+func TestTelemetryIsBounded(t *testing.T) {
+	var tm eventRing
+	for i := 0; i < maxTelemetryEvents+5; i++ {
+		tm.add(map[string]interface{}{"i": i}, maxTelemetryEvents)
+	}
+
+	events := tm.snapshot()
+	if len(events) != maxTelemetryEvents {
+		t.Fatalf("expected %d events, got %d", maxTelemetryEvents, len(events))
+	}
+	if first, last := events[0]["i"], events[len(events)-1]["i"]; first != 5 || last != maxTelemetryEvents+4 {
+		t.Errorf("expected the newest events in order, got %v to %v", first, last)
+	}
+}
+
+func TestNoTelemetryWithoutObservedEntries(t *testing.T) {
+	h := NewHook("", "testing")
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	body := ft.sent[0]["data"].(map[string]interface{})["body"].(map[string]interface{})
+	if _, exists := body["telemetry"]; exists {
+		t.Errorf("expected no telemetry, got %v", body["telemetry"])
+	}
+}
+
+func TestWithRecentLogs(t *testing.T) {
+	h := NewHook("", "testing", WithRecentLogs(2))
+	ft := withFakeTransport(h, &fakeTransport{})
+	if len(h.Levels()) != len(logrus.AllLevels) {
+		t.Fatalf("expected the hook to see all levels, got %v", h.Levels())
+	}
+
+	l := logrus.New()
+	l.SetLevel(logrus.DebugLevel)
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+	l.Info("first")
+	l.Debug("second")
+	l.Warn("third")
+	l.Error("This is a test")
+
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected only the error to be reported, got %d items", len(ft.sent))
+	}
+	custom := ft.sent[0]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	logs, ok := custom["recent_logs"].([]map[string]interface{})
+	if !ok || len(logs) != 2 {
+		t.Fatalf("expected the 2 most recent logs, got %v", custom["recent_logs"])
+	}
+	if logs[0]["message"] != "second" || logs[0]["level"] != "debug" || logs[1]["message"] != "third" {
+		t.Errorf("unexpected recent logs %v", logs)
+	}
+	if _, err := time.Parse(time.RFC3339, logs[1]["time"].(string)); err != nil {
+		t.Errorf("expected an RFC3339 time, got %v", logs[1]["time"])
+	}
+
+	l.Error("This is another test")
+	custom = ft.sent[1]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if logs, exists := custom["recent_logs"]; exists {
+		t.Errorf("expected the logs to be attached to the first error only, got %v", logs)
+	}
+}
@@ -0,0 +1,99 @@
+package rollrus
+
+import (
+	"sync"
+
+	"github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+// tokenClients holds the clients the hook created for the tokens of
+// WithLevelTokens and WithTokenRouter, keyed by token.
+type tokenClients struct {
+	mu      sync.Mutex
+	clients map[string]*rollbar.Client
+}
+
+// tokenClient returns the client reporting with token. Clients for tokens
+// other than the one of the hook's client are created on first use with the
+// settings of the hook's client.
+func (r *Hook) tokenClient(token string) *rollbar.Client {
+	if token == "" || token == r.Client.Token() {
+		return r.Client
+	}
+
+	r.tokenClients.mu.Lock()
+	defer r.tokenClients.mu.Unlock()
+	if c, ok := r.tokenClients.clients[token]; ok {
+		return c
+	}
+
+	src := r.Client
+	c := rollbar.NewSync(token, src.Environment(), src.CodeVersion(), src.ServerHost(), src.ServerRoot())
+	c.SetEndpoint(src.Endpoint())
+	c.SetPlatform(src.Platform())
+	c.SetCustom(src.Custom())
+	c.SetFingerprint(src.Fingerprint())
+	c.SetCaptureIp(src.CaptureIp())
+	c.SetScrubHeaders(src.ScrubHeaders())
+	c.SetScrubFields(src.ScrubFields())
+	c.Transport = newTransport(r, derivedTransport(src.Transport, token, src.Endpoint()))
+
+	if r.tokenClients.clients == nil {
+		r.tokenClients.clients = make(map[string]*rollbar.Client)
+	}
+	r.tokenClients.clients[token] = c
+	return c
+}
+
+// derivedTransport returns a transport like t, unwrapping the one of rollrus,
+// that sends items with token.
+func derivedTransport(t rollbar.Transport, token, endpoint string) rollbar.Transport {
+	if w, ok := t.(*transport); ok {
+		t = w.Transport
+	}
+	switch t := t.(type) {
+	case *rollbar.AsyncTransport:
+		async := rollbar.NewAsyncTransport(token, endpoint, t.Buffer)
+		async.SetLogger(t.Logger)
+		async.SetRetryAttempts(t.RetryAttempts)
+		async.SetPrintPayloadOnError(t.PrintPayloadOnError)
+		return async
+	case *httpTransport:
+		return newHTTPTransport(t.client, token, endpoint, t.SyncTransport)
+	case noopTransport:
+		return t
+	case *rollbar.SyncTransport:
+		st := rollbar.NewSyncTransport(token, endpoint)
+		st.SetLogger(t.Logger)
+		st.SetRetryAttempts(t.RetryAttempts)
+		st.SetPrintPayloadOnError(t.PrintPayloadOnError)
+		return st
+	}
+	return rollbar.NewSyncTransport(token, endpoint)
+}
+
+// eachTokenClient calls fn with each client created by tokenClient.
+func (r *Hook) eachTokenClient(fn func(*rollbar.Client)) {
+	r.tokenClients.mu.Lock()
+	clients := make([]*rollbar.Client, 0, len(r.tokenClients.clients))
+	for _, c := range r.tokenClients.clients {
+		clients = append(clients, c)
+	}
+	r.tokenClients.mu.Unlock()
+
+	for _, c := range clients {
+		fn(c)
+	}
+}
+
+// entryToken returns the token selected for the entry by WithTokenRouter or
+// WithLevelTokens, or the empty string if there is none.
+func (r *Hook) entryToken(entry *logrus.Entry) string {
+	if r.tokenRouter != nil {
+		if token := r.tokenRouter(entry); token != "" {
+			return token
+		}
+	}
+	return r.levelTokens[entry.Level]
+}
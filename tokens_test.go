@@ -0,0 +1,79 @@
+package rollrus
+
+import (
+	"testing"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithLevelTokens(t *testing.T) {
+	h := NewHook("normal", "testing",
+		WithEndpoint("https://rollbar.example.com/api/1/item/"),
+		WithLevelTokens(map[logrus.Level]string{logrus.PanicLevel: "paging", logrus.FatalLevel: "paging"}),
+	)
+	ft := withFakeTransport(h, &fakeTransport{})
+
+	paging := h.tokenClient("paging")
+	if paging == h.Client {
+		t.Fatal("expected a client of its own for the paging token")
+	}
+	if paging.Token() != "paging" || paging.Environment() != "testing" || paging.Endpoint() != h.Client.Endpoint() {
+		t.Errorf("expected the settings of the hook's client, got token %q, environment %q and endpoint %q",
+			paging.Token(), paging.Environment(), paging.Endpoint())
+	}
+	if h.tokenClient("paging") != paging {
+		t.Error("expected the client to be reused")
+	}
+	pt := &fakeTransport{SyncTransport: rollbar.NewSyncTransport("paging", "")}
+	paging.Transport.(*transport).Transport = pt
+
+	entry := logrus.NewEntry(nil)
+	entry.Message = "This is a test"
+	for _, l := range []logrus.Level{logrus.ErrorLevel, logrus.PanicLevel} {
+		entry.Level = l
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if len(ft.sent) != 1 || len(pt.sent) != 1 {
+		t.Fatalf("expected one item for each token, got %d and %d", len(ft.sent), len(pt.sent))
+	}
+	if level := pt.sent[0]["data"].(map[string]interface{})["level"]; level != rollbar.CRIT {
+		t.Errorf("expected the panic to be sent with the paging token, got level %v", level)
+	}
+
+	h.SetEnvironment("staging")
+	if paging.Environment() != "staging" {
+		t.Errorf("expected SetEnvironment to change the paging client, got %q", paging.Environment())
+	}
+}
+
+func TestWithTokenRouter(t *testing.T) {
+	h := NewHook("default", "testing", WithTokenRouter(func(entry *logrus.Entry) string {
+		tenant, _ := entry.Data["tenant"].(string)
+		return map[string]string{"acme": "acme-token"}[tenant]
+	}))
+	ft := withFakeTransport(h, &fakeTransport{})
+	acme := h.tokenClient("acme-token")
+	at := &fakeTransport{SyncTransport: rollbar.NewSyncTransport("acme-token", "")}
+	acme.Transport.(*transport).Transport = at
+
+	for _, tenant := range []string{"acme", "initech", ""} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		entry.Data["tenant"] = tenant
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if len(at.sent) != 1 {
+		t.Errorf("expected the acme entry to be sent with its token, got %d sent", len(at.sent))
+	}
+	if len(ft.sent) != 2 {
+		t.Errorf("expected the other entries to be sent with the default token, got %d sent", len(ft.sent))
+	}
+}
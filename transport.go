@@ -0,0 +1,121 @@
+package rollrus
+
+import (
+	"net/http"
+
+	"github.com/rollbar/rollbar-go"
+)
+
+// transport wraps the rollbar.Transport of a Hook's client so that the hook
+// can act on the outcome of sending an item.
+type transport struct {
+	rollbar.Transport
+	hook *Hook
+}
+
+// newTransport wraps t for use by h.
+func newTransport(h *Hook, t rollbar.Transport) *transport {
+	return &transport{Transport: t, hook: h}
+}
+
+// Send the body using the wrapped transport after applying the occurrence of
+// the item, if any, retrying failed attempts as configured with WithRetry of
+// the hook that reported the item.
+func (t *transport) Send(body map[string]interface{}) error {
+	var o *occurrence
+	if data, ok := body["data"].(map[string]interface{}); ok {
+		if o = popOccurrence(data); o != nil {
+			o.apply(data)
+		}
+	}
+
+	h := t.hook
+	if o != nil && o.hook != nil {
+		h = o.hook
+	}
+
+	err := t.Transport.Send(body)
+
+	backoff := h.retryBackoff
+	for attempt := 1; err != nil && attempt < h.retryAttempts && isRetryable(err); attempt++ {
+		if h.logger != nil {
+			h.logger.WithField(diagnosticField, true).WithError(err).Infof("rollrus: retrying report in %v", backoff)
+		}
+		h.timer().Sleep(backoff)
+		backoff *= 2
+
+		err = t.Transport.Send(body)
+	}
+
+	if o != nil {
+		o.err = err
+		h.countSent(err)
+		if err != nil && h.errorHandler != nil {
+			h.errorHandler(o.entry, err)
+		}
+	}
+	if err != nil {
+		if _, ok := err.(rollbar.ErrBufferFull); ok {
+			h.warnf("the async buffer is full, report dropped")
+		}
+		h.fail(err)
+	}
+
+	return err
+}
+
+// async reports whether the wrapped transport sends asynchronously.
+func (t *transport) async() bool {
+	_, ok := t.Transport.(*rollbar.AsyncTransport)
+	return ok
+}
+
+// setAsync replaces the wrapped transport with an asynchronous one queueing up
+// to buffer items, keeping the settings of a wrapped rollbar.SyncTransport.
+// The retries that WithRetry disabled are restored, as the hook can't retry
+// asynchronous sends. The transport of WithHTTPClient is kept, as rollbar's
+// asynchronous transport can't use another http.Client.
+func (t *transport) setAsync(token, endpoint string, buffer int) {
+	if _, ok := t.Transport.(*httpTransport); ok {
+		t.hook.warnf("asynchronous sending can't be combined with WithHTTPClient, sending synchronously")
+		return
+	}
+	async := rollbar.NewAsyncTransport(token, endpoint, buffer)
+	if sync, ok := t.Transport.(*rollbar.SyncTransport); ok {
+		async.SetLogger(sync.Logger)
+		if t.hook.retryAttempts == 0 {
+			async.SetRetryAttempts(sync.RetryAttempts)
+		}
+		async.SetPrintPayloadOnError(sync.PrintPayloadOnError)
+	}
+	t.Transport = async
+}
+
+// isRetryable reports whether sending an item that failed with err may
+// succeed when tried again. Client errors other than rate limiting are
+// permanent, and so is a full async buffer, as waiting for it to drain would
+// block the logging goroutine.
+func isRetryable(err error) bool {
+	switch err := err.(type) {
+	case rollbar.ErrHTTPError:
+		return err == http.StatusTooManyRequests || err >= http.StatusInternalServerError
+	case rollbar.ErrBufferFull:
+		return false
+	}
+	return true
+}
+
+// setHTTPClient replaces the wrapped transport with one posting items with
+// client, keeping the settings of a wrapped rollbar.SyncTransport.
+func (t *transport) setHTTPClient(token, endpoint string, client *http.Client) {
+	switch wrapped := t.Transport.(type) {
+	case *rollbar.AsyncTransport:
+		t.hook.warnf("WithHTTPClient can't be combined with asynchronous sending, ignoring it")
+	case *httpTransport:
+		wrapped.client = client
+	case *rollbar.SyncTransport:
+		t.Transport = newHTTPTransport(client, token, endpoint, wrapped)
+	default:
+		t.Transport = newHTTPTransport(client, token, endpoint, nil)
+	}
+}
@@ -0,0 +1,447 @@
+package rollrus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rollbar "github.com/rollbar/rollbar-go"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeTransport records the items it is asked to send and fails the first
+// failures attempts with err. When entered is set, Send signals on it and then
+// blocks until release is closed.
+type fakeTransport struct {
+	*rollbar.SyncTransport
+	err      error
+	failures int
+	entered  chan struct{}
+	release  chan struct{}
+
+	mu   sync.Mutex
+	sent []map[string]interface{}
+}
+
+func (t *fakeTransport) Send(body map[string]interface{}) error {
+	if t.entered != nil {
+		t.entered <- struct{}{}
+		<-t.release
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = append(t.sent, body)
+	if len(t.sent) <= t.failures {
+		return t.err
+	}
+	return nil
+}
+
+// withFakeTransport replaces the transport wrapped by the hook's client.
+func withFakeTransport(h *Hook, ft *fakeTransport) *fakeTransport {
+	ft.SyncTransport = rollbar.NewSyncTransport("", "")
+	h.Client.Transport.(*transport).Transport = ft
+	return ft
+}
+
+func TestWithRetry(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		failures int
+		attempts int
+	}{
+		{name: "succeeds after retries", err: rollbar.ErrHTTPError(http.StatusServiceUnavailable), failures: 2, attempts: 3},
+		{name: "gives up after attempts", err: rollbar.ErrHTTPError(http.StatusTooManyRequests), failures: 10, attempts: 4},
+		{
+			name:     "permanent errors are not retried",
+			err:      rollbar.ErrHTTPError(http.StatusUnauthorized),
+			failures: 10,
+			attempts: 1,
+		},
+		{name: "a full async buffer is not retried", err: rollbar.ErrBufferFull{}, failures: 10, attempts: 1},
+	}
+
+	backoffs := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for _, c := range cases {
+		clock := newFakeClock(time.Now())
+		h := NewHook("", "testing", WithClock(clock), WithRetry(4, time.Second))
+		ft := withFakeTransport(h, &fakeTransport{err: c.err, failures: c.failures})
+
+		if err := h.Client.Transport.Send(map[string]interface{}{}); (err != nil) != (c.failures >= c.attempts) {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if len(ft.sent) != c.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", c.name, c.attempts, len(ft.sent))
+		}
+		if want := backoffs[:c.attempts-1]; fmt.Sprint(clock.sleeps) != fmt.Sprint(want) {
+			t.Errorf("%s: expected to wait %v, got %v", c.name, want, clock.sleeps)
+		}
+	}
+}
+
+func TestWithRetryKeepsAsyncRetries(t *testing.T) {
+	for _, opts := range [][]OptionFunc{
+		{WithAsync(0), WithRetry(4, time.Millisecond)},
+		{WithRetry(4, time.Millisecond), WithAsync(0)},
+	} {
+		h := NewHook("some-token", "testing", opts...)
+		async, ok := h.Client.Transport.(*transport).Transport.(*rollbar.AsyncTransport)
+		if !ok {
+			t.Fatalf("expected an async transport, got %T", h.Client.Transport.(*transport).Transport)
+		}
+		if async.RetryAttempts != rollbar.DefaultRetryAttempts {
+			t.Errorf("expected the async transport to keep retrying, got %d retry attempts", async.RetryAttempts)
+		}
+	}
+
+	h := NewHook("some-token", "testing", WithRetry(4, time.Millisecond))
+	if sync := h.Client.Transport.(*transport).Transport.(*rollbar.SyncTransport); sync.RetryAttempts != 0 {
+		t.Errorf("expected the retries of a sync transport to be disabled, got %d", sync.RetryAttempts)
+	}
+}
+
+func TestWithOnError(t *testing.T) {
+	var got []error
+	h := NewHook("", "testing", WithOnError(func(err error) {
+		got = append(got, err)
+	}))
+	sendErr := rollbar.ErrHTTPError(http.StatusUnauthorized)
+	withFakeTransport(h, &fakeTransport{err: sendErr, failures: 1})
+
+	_ = h.Client.Transport.Send(map[string]interface{}{})
+	_ = h.Client.Transport.Send(map[string]interface{}{})
+
+	if len(got) != 1 || got[0] != sendErr {
+		t.Fatalf("expected the send error to be passed to the callback once, got %v", got)
+	}
+}
+
+func TestWithErrorHandler(t *testing.T) {
+	var entries []*logrus.Entry
+	var errs []error
+	h := NewHook("", "testing", WithErrorHandler(func(entry *logrus.Entry, err error) {
+		entries = append(entries, entry)
+		errs = append(errs, err)
+	}))
+	sendErr := rollbar.ErrHTTPError(http.StatusUnauthorized)
+	withFakeTransport(h, &fakeTransport{err: sendErr, failures: 1})
+
+	for _, msg := range []string{"first", "second"} {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = msg
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	if len(errs) != 1 || errs[0] != sendErr {
+		t.Fatalf("expected the send error to be passed once, got %v", errs)
+	}
+	if entries[0].Message != "first" {
+		t.Errorf("expected the failed entry to be passed, got %q", entries[0].Message)
+	}
+}
+
+func TestWithPropagateErrors(t *testing.T) {
+	sendErr := rollbar.ErrHTTPError(http.StatusUnauthorized)
+	for _, propagate := range []bool{false, true} {
+		var opts []OptionFunc
+		if propagate {
+			opts = append(opts, WithPropagateErrors())
+		}
+		h := NewHook("", "testing", opts...)
+		withFakeTransport(h, &fakeTransport{err: sendErr, failures: 1})
+
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		if err := h.Fire(entry); propagate && err != sendErr || !propagate && err != nil {
+			t.Errorf("propagate %v: unexpected error %v", propagate, err)
+		}
+		if err := h.Fire(entry); err != nil {
+			t.Errorf("propagate %v: unexpected error %v after a successful send", propagate, err)
+		}
+	}
+
+	h := NewHook("", "testing", WithPropagateErrors(), WithItemsPerMinuteLimit(1))
+	withFakeTransport(h, &fakeTransport{})
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	_ = h.Fire(entry)
+	if err := h.Fire(entry); err != ErrRateLimited {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	diag := logrus.New()
+	diag.SetOutput(&buf)
+	diag.SetFormatter(&logrus.JSONFormatter{})
+
+	h := NewHook("", "testing", WithLevels(logrus.WarnLevel, logrus.ErrorLevel), WithLogger(diag),
+		WithRetry(2, time.Millisecond))
+	ft := withFakeTransport(h, &fakeTransport{err: rollbar.ErrHTTPError(http.StatusServiceUnavailable), failures: 2})
+	// the hook is attached to the diagnostics logger as well, but must not
+	// report its own diagnostics
+	diag.AddHook(h)
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHook(h)
+
+	l.Error("This is a test")
+
+	if len(ft.sent) != 2 {
+		t.Fatalf("expected the retry but no reports of the diagnostics, got %d sent", len(ft.sent))
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`"msg":"rollrus: retrying report in 1ms"`,
+		`"msg":"rollrus: report failed"`,
+		`"level":"warning"`,
+		`"rollrus_diagnostic":true`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s to be logged, got %s", want, out)
+		}
+	}
+	if h.WillReport(diag.WithField(diagnosticField, true)) {
+		t.Error("expected diagnostics not to be reported")
+	}
+}
+
+func TestWithConcurrencyLimit(t *testing.T) {
+	var dropped []error
+	h := NewHook("", "testing", WithConcurrencyLimit(1, 0), WithOnError(func(err error) {
+		dropped = append(dropped, err)
+	}))
+	ft := withFakeTransport(h, &fakeTransport{entered: make(chan struct{}), release: make(chan struct{})})
+
+	newEntry := func() *logrus.Entry {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		return entry
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = h.Fire(newEntry())
+	}()
+	<-ft.entered
+
+	if err := h.Fire(newEntry()); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if len(dropped) != 1 || dropped[0] != ErrConcurrencyLimit {
+		t.Fatalf("expected the second report to be dropped, got %v", dropped)
+	}
+
+	close(ft.release)
+	<-done
+	if len(ft.sent) != 1 {
+		t.Fatalf("expected 1 report to be sent, got %d", len(ft.sent))
+	}
+}
+
+func TestWithAsyncBufferSize(t *testing.T) {
+	received := make(chan struct{}, 10)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	var failures []error
+	h := NewHook("some-token", "testing", WithDiagnosticWriter(&buf), WithAsyncBufferSize(1), WithOnError(func(err error) {
+		failures = append(failures, err)
+	}))
+	h.Client.SetEndpoint(ts.URL)
+	h.Client.SetPrintPayloadOnError(false)
+	if _, ok := h.Client.Transport.(*transport).Transport.(*rollbar.AsyncTransport); !ok {
+		t.Fatalf("expected an async transport, got %T", h.Client.Transport.(*transport).Transport)
+	}
+
+	fire := func() {
+		entry := logrus.NewEntry(nil)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "This is a test"
+		if err := h.Fire(entry); err != nil {
+			t.Fatal("unexpected error ", err)
+		}
+	}
+
+	fire()
+	<-received
+	fire()
+	fire()
+	close(release)
+	h.Client.Wait()
+
+	if len(failures) != 1 || failures[0] != (rollbar.ErrBufferFull{}) {
+		t.Fatalf("expected one report to be dropped, got %v", failures)
+	}
+	if !strings.Contains(buf.String(), "rollrus: the async buffer is full") {
+		t.Errorf("expected a warning about the full buffer, got %q", buf.String())
+	}
+}
+
+func TestWithAsyncBufferSizeRejectsNonPositiveSize(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		var buf bytes.Buffer
+		h := NewHook("some-token", "testing", WithDiagnosticWriter(&buf), WithAsyncBufferSize(n))
+		if _, ok := h.Client.Transport.(*transport).Transport.(*rollbar.SyncTransport); !ok {
+			t.Errorf("%d: expected the sync transport to be kept, got %T", n, h.Client.Transport.(*transport).Transport)
+		}
+		if !strings.Contains(buf.String(), "WithAsyncBufferSize needs a positive size") {
+			t.Errorf("%d: expected a warning, got %q", n, buf.String())
+		}
+	}
+}
+
+func TestWithAsync(t *testing.T) {
+	received := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer ts.Close()
+
+	h := NewHook("some-token", "testing", WithAsync(0))
+	h.Client.SetEndpoint(ts.URL)
+	async, ok := h.Client.Transport.(*transport).Transport.(*rollbar.AsyncTransport)
+	if !ok {
+		t.Fatalf("expected an async transport, got %T", h.Client.Transport.(*transport).Transport)
+	}
+	if async.Buffer != rollbar.DefaultBuffer {
+		t.Errorf("expected the default buffer size, got %d", async.Buffer)
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	select {
+	case <-received:
+	default:
+		t.Fatal("expected Close to wait for the report to be sent")
+	}
+}
+
+func TestWithEndpoint(t *testing.T) {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer ts.Close()
+
+	h := NewHook("some-token", "testing", WithEndpoint(ts.URL+"/api/1/item/"))
+	if h.Client.Endpoint() != ts.URL+"/api/1/item/" {
+		t.Fatalf("unexpected endpoint %q", h.Client.Endpoint())
+	}
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	select {
+	case path := <-received:
+		if path != "/api/1/item/" {
+			t.Errorf("got path %q", path)
+		}
+	default:
+		t.Fatal("expected the report to be sent to the endpoint")
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper calling itself.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWithHTTPClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var requests []string
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		requests = append(requests, r.URL.String())
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	h := NewHook("some-token", "testing", WithHTTPClient(client), WithEndpoint(ts.URL))
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+	if err := h.Ping(context.Background()); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(requests) != 2 || requests[0] != ts.URL {
+		t.Fatalf("expected the report and the ping to use the client, got %v", requests)
+	}
+	if s := h.Stats(); s.Reported != 1 {
+		t.Errorf("expected one report, got %+v", s)
+	}
+}
+
+func TestWithHTTPClientHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer ts.Close()
+
+	var failures []error
+	h := NewHook("some-token", "testing", WithHTTPClient(ts.Client()), WithOnError(func(err error) {
+		failures = append(failures, err)
+	}))
+	h.Client.SetEndpoint(ts.URL)
+	h.Client.SetPrintPayloadOnError(false)
+	h.Client.SetLogger(&rollbar.SilentClientLogger{})
+
+	entry := logrus.NewEntry(nil)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "This is a test"
+	if err := h.Fire(entry); err != nil {
+		t.Fatal("unexpected error ", err)
+	}
+
+	if len(failures) != 1 || failures[0] != rollbar.ErrHTTPError(http.StatusUnprocessableEntity) {
+		t.Errorf("expected the HTTP status as failure, got %v", failures)
+	}
+}
+
+func TestWithHTTPClientAsync(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHook("some-token", "testing", WithDiagnosticWriter(&buf), WithHTTPClient(http.DefaultClient), WithAsync(0))
+	if _, ok := h.Client.Transport.(*transport).Transport.(*httpTransport); !ok {
+		t.Fatalf("expected the HTTP client to be kept, got %T", h.Client.Transport.(*transport).Transport)
+	}
+	if !strings.Contains(buf.String(), "WithHTTPClient") {
+		t.Errorf("expected a warning, got %q", buf.String())
+	}
+}
@@ -0,0 +1,54 @@
+package rollrus
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Validate checks the hook for common misconfigurations that would otherwise
+// only show as items silently not being reported, like an empty token, an
+// invalid endpoint or level options overriding each other. It returns an error describing all problems found, or nil.
+// Apps can call it at startup to fail fast.
+func (r *Hook) Validate() error {
+	var problems []string
+	if r.Client == nil {
+		return errNoClient
+	}
+
+	if r.Client.Token() == "" {
+		problems = append(problems, "the token is empty")
+	}
+	if r.Client.Environment() == "" {
+		problems = append(problems, "the environment is empty")
+	}
+	u, err := url.Parse(r.Client.Endpoint())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "the endpoint "+r.Client.Endpoint()+" is not an http(s) URL")
+	}
+
+	if r.triggersConflict != "" {
+		problems = append(problems, r.triggersConflict)
+	}
+
+	levels := r.triggerLevels()
+	if len(levels) == 0 {
+		problems = append(problems, "no levels are reported")
+	} else if r.levelFilter != nil {
+		filtered := true
+		for _, l := range levels {
+			if r.levelFilter(l) {
+				filtered = false
+				break
+			}
+		}
+		if filtered {
+			problems = append(problems, "the level filter excludes all reported levels")
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("rollrus: invalid hook: " + strings.Join(problems, ", "))
+}
@@ -0,0 +1,65 @@
+package rollrus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidate(t *testing.T) {
+	belowError := func(l logrus.Level) bool { return l > logrus.ErrorLevel }
+	cases := []struct {
+		name     string
+		hook     *Hook
+		problems []string
+	}{
+		{name: "valid", hook: NewHook("some-token", "testing")},
+		{name: "no client", hook: &Hook{}, problems: []string{"no rollbar client"}},
+		{
+			name:     "empty token and environment",
+			hook:     NewHook("", ""),
+			problems: []string{"token is empty", "environment is empty"},
+		},
+		{
+			name:     "no levels",
+			hook:     NewHook("some-token", "testing", WithLevels([]logrus.Level{}...)),
+			problems: []string{"no levels are reported"},
+		},
+		{
+			name:     "conflicting level options",
+			hook:     NewHook("some-token", "testing", WithLevels(logrus.WarnLevel), WithMinLevel(logrus.ErrorLevel)),
+			problems: []string{"WithMinLevel overrides the levels set by WithLevels"},
+		},
+		{
+			name:     "level filter excludes everything",
+			hook:     NewHook("some-token", "testing", WithLevelFilter(belowError)),
+			problems: []string{"level filter excludes all reported levels"},
+		},
+	}
+
+	for _, c := range cases {
+		err := c.hook.Validate()
+		if len(c.problems) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+			continue
+		}
+		for _, p := range c.problems {
+			if !strings.Contains(err.Error(), p) {
+				t.Errorf("%s: expected %q in %q", c.name, p, err)
+			}
+		}
+	}
+
+	h := NewHook("some-token", "testing")
+	h.Client.SetEndpoint("not a url")
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "endpoint") {
+		t.Errorf("expected an invalid endpoint error, got %v", err)
+	}
+}